@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ttd2089/pocket/supervise"
+	"github.com/ttd2089/pocket/watch"
+)
+
+// The state of the session reported by the control API.
+type controlStatus struct {
+	Running       bool      `json:"running"`
+	Pid           int       `json:"pid,omitempty"`
+	StartTime     time.Time `json:"start_time"`
+	UptimeSeconds float64   `json:"uptime_seconds,omitempty"`
+	Runs          int       `json:"runs"`
+	LastExitCode  *int      `json:"last_exit_code,omitempty"`
+	Paused        bool      `json:"paused"`
+}
+
+// The body of an error response from the control API.
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// Listens for control API connections on the Unix socket at the given path or,
+// when the path is empty, on the given loopback address.
+func listenControl(socket string, addr string) (net.Listener, error) {
+	if socket == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid control address %s: %v", addr, err)
+		}
+		// Anyone who can connect can run the command so stay off the network.
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("invalid control address %s: the host must be a loopback address", addr)
+		}
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Lstat(socket); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("control socket %s exists and is not a socket", socket)
+		}
+		// A socket that nothing answers on was left behind by a pocket that
+		// didn't get to clean up.
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket %s: %v", socket, err)
+		}
+	}
+	return listenUnix(socket)
+}
+
+// Creates the handler for the control API. Requests must name a loopback host
+// so a web page can't reach the API by rebinding its domain, and POSTs must
+// have an X-Pocket header or a JSON Content-Type so a page can't send one
+// without a preflight we don't answer.
+//
+//	GET  /status         the state of the command and the session
+//	POST /restart        restart the command
+//	POST /start          start the command if it's stopped
+//	POST /stop           stop the command
+//	POST /pause          hold changes rather than restarting for them
+//	POST /resume         stop holding changes and catch up on them
+//	GET  /watched        the watched directories
+//	GET  /events?limit=n the most recent events
+func (s *session) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", allow(http.MethodGet, func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.status())
+	}))
+	mux.HandleFunc("/restart", allow(http.MethodPost, s.control(s.restart)))
+	mux.HandleFunc("/start", allow(http.MethodPost, s.control(s.runner.Start)))
+	mux.HandleFunc("/stop", allow(http.MethodPost, s.control(s.runner.Stop)))
+	mux.HandleFunc("/pause", allow(http.MethodPost, s.control(func() error {
+		s.pause()
+		return nil
+	})))
+	mux.HandleFunc("/resume", allow(http.MethodPost, s.control(s.resume)))
+	mux.HandleFunc("/watched", allow(http.MethodGet, func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string][]string{"dirs": s.dw.Watched()})
+	}))
+	mux.HandleFunc("/events", allow(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+				writeJSON(w, http.StatusBadRequest, controlError{Error: "limit must be a non-negative integer"})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string][]sessionEvent{"events": s.recent(limit)})
+	}))
+	return guard(mux)
+}
+
+// Wraps the control API's handler to refuse requests a web page could make.
+func guard(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			writeJSON(w, http.StatusForbidden, controlError{Error: "the host must be a loopback address"})
+			return
+		}
+		if r.Method == http.MethodPost && r.Header.Get("X-Pocket") == "" && !isJSON(r.Header.Get("Content-Type")) {
+			writeJSON(w, http.StatusForbidden, controlError{Error: "POST requests need an X-Pocket header or a JSON Content-Type"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Indicates whether the Host of a request, with or without a port, is
+// localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Indicates whether a Content-Type is JSON.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// Creates a handler that performs an action and responds with the status.
+func (s *session) control(action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if err := action(); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, supervise.ErrRunning) {
+				code = http.StatusConflict
+			}
+			writeJSON(w, code, controlError{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.status())
+	}
+}
+
+// Describes the state of the session for the control API.
+func (s *session) status() controlStatus {
+	st := s.runner.Status()
+	status := controlStatus{
+		Running:   st.Running,
+		Pid:       st.Pid,
+		StartTime: st.StartTime,
+		Runs:      st.Runs,
+		Paused:    s.isPaused(),
+	}
+	if st.Running {
+		status.UptimeSeconds = time.Since(st.StartTime).Seconds()
+	}
+	if st.HasExited {
+		status.LastExitCode = &st.LastExitCode
+	}
+	return status
+}
+
+// Wraps a handler to respond with 405 to other methods than the given one.
+func allow(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, controlError{Error: "method not allowed"})
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Writes v as the JSON body of a response.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logRecord(watch.LevelWarn, watch.RecordError, watch.Fields{"error": err.Error()}, "control API write error: %v", err)
+	}
+}
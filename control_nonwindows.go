@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// Listens on a unix socket that only the user can connect to. The umask keeps
+// the socket private from the moment it's created rather than after a chmod.
+// It applies to the whole process so we only listen before the command starts.
+func listenUnix(socket string) (net.Listener, error) {
+	umask := syscall.Umask(0177)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", socket)
+}
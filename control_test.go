@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ttd2089/pocket/supervise"
+)
+
+func Test_listenControl(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the control socket is a Unix socket")
+	}
+
+	t.Run("Refuses to replace a file that isn't a socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "notes.txt")
+		if err := os.WriteFile(path, []byte("important\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := listenControl(path, ""); err == nil || !strings.Contains(err.Error(), "exists and is not a socket") {
+			t.Errorf("listenControl(); expected an error about the file, got %v", err)
+		}
+		if content, err := os.ReadFile(path); err != nil || string(content) != "important\n" {
+			t.Errorf("expected the file to be left alone, got %q, %v", content, err)
+		}
+	})
+
+	t.Run("Creates a socket only the user can connect to", func(t *testing.T) {
+		dir := t.TempDir()
+		before := filepath.Join(dir, "before.txt")
+		if err := os.WriteFile(before, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "pocket.sock")
+		l, err := listenControl(path, "")
+		if err != nil {
+			t.Fatalf("unexpected error from listenControl(): %+v", err)
+		}
+		defer l.Close()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("expected the socket's mode to be 0600, got %v", fi.Mode().Perm())
+		}
+		// The umask is the process's so it has to be put back.
+		after := filepath.Join(dir, "after.txt")
+		if err := os.WriteFile(after, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := os.Stat(before)
+		a, _ := os.Stat(after)
+		if b.Mode().Perm() != a.Mode().Perm() {
+			t.Errorf("expected files to be created with mode %v after listening, got %v", b.Mode().Perm(), a.Mode().Perm())
+		}
+	})
+
+	t.Run("Replaces a stale socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pocket.sock")
+		stale, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Leave the socket file behind like a pocket that was killed.
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+		l, err := listenControl(path, "")
+		if err != nil {
+			t.Fatalf("unexpected error from listenControl(): %+v", err)
+		}
+		l.Close()
+	})
+
+	t.Run("Refuses a socket that's in use", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pocket.sock")
+		l, err := listenControl(path, "")
+		if err != nil {
+			t.Fatalf("unexpected error from listenControl(): %+v", err)
+		}
+		defer l.Close()
+		if _, err := listenControl(path, ""); err == nil || !strings.Contains(err.Error(), "in use") {
+			t.Errorf("listenControl(); expected an error about the socket being in use, got %v", err)
+		}
+	})
+
+	t.Run("Refuses an address that isn't loopback", func(t *testing.T) {
+		if _, err := listenControl("", "0.0.0.0:0"); err == nil {
+			t.Errorf("listenControl(); expected an error, got nil")
+		}
+	})
+}
+
+func Test_session_controlHandler(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		host     string
+		header   map[string]string
+		err      error
+		code     int
+		calls    []string
+		expected string
+	}{
+		{name: "GET /status reports the state", method: "GET", target: "/status", code: 200, expected: `"runs":3`},
+		{name: "POST /restart restarts", method: "POST", target: "/restart", header: map[string]string{"X-Pocket": "1"}, code: 200, calls: []string{"restart"}},
+		{name: "POST /stop with a JSON Content-Type stops", method: "POST", target: "/stop", header: map[string]string{"Content-Type": "application/json; charset=utf-8"}, code: 200, calls: []string{"stop"}},
+		{name: "POST /pause pauses", method: "POST", target: "/pause", header: map[string]string{"X-Pocket": "1"}, code: 200, expected: `"paused":true`},
+		{name: "POST /start while running conflicts", method: "POST", target: "/start", header: map[string]string{"X-Pocket": "1"}, err: supervise.ErrRunning, code: 409, calls: []string{"start"}},
+		{name: "Errors from the runner are reported", method: "POST", target: "/restart", header: map[string]string{"X-Pocket": "1"}, err: errors.New("runner error"), code: 500, calls: []string{"restart"}, expected: "runner error"},
+		{name: "Other methods aren't allowed", method: "GET", target: "/restart", code: 405},
+		{name: "A preflight isn't answered", method: "OPTIONS", target: "/restart", code: 405},
+		{name: "POST without the header is refused", method: "POST", target: "/restart", code: 403},
+		{name: "POST with a form Content-Type is refused", method: "POST", target: "/stop", header: map[string]string{"Content-Type": "text/plain"}, code: 403},
+		{name: "A host that isn't loopback is refused", method: "GET", target: "/status", host: "evil.example:8080", code: 403},
+		{name: "A loopback address with a port is allowed", method: "GET", target: "/status", host: "127.0.0.1:8080", code: 200},
+		{name: "An IPv6 loopback address is allowed", method: "GET", target: "/status", host: "[::1]:8080", code: 200},
+		{name: "GET /watched lists the directories", method: "GET", target: "/watched", code: 200, expected: `"dirs":[]`},
+		{name: "GET /events lists the events", method: "GET", target: "/events?limit=1", code: 200, expected: `"events":[]`},
+		{name: "GET /events refuses a negative limit", method: "GET", target: "/events?limit=-1", code: 400},
+		{name: "GET /events refuses a limit that isn't a number", method: "GET", target: "/events?limit=x", code: 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, runner, _ := newTestSession()
+			runner.status = supervise.Status{Runs: 3}
+			runner.err = test.err
+			r := httptest.NewRequest(test.method, test.target, nil)
+			r.Host = "localhost"
+			if test.host != "" {
+				r.Host = test.host
+			}
+			for k, v := range test.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.controlHandler().ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Errorf("expected status %d, got %d: %s", test.code, w.Code, w.Body.String())
+			}
+			if calls := runner.made(); fmt.Sprint(calls) != fmt.Sprint(test.calls) {
+				t.Errorf("expected calls %v, got %v", test.calls, calls)
+			}
+			if !strings.Contains(w.Body.String(), test.expected) {
+				t.Errorf("expected the body to contain %q, got %q", test.expected, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected a JSON response, got %q", ct)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// Listens on a unix socket. Windows has no umask so the mode is set once the
+// socket exists.
+func listenUnix(socket string) (net.Listener, error) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/ttd2089/pocket/envfile"
+)
+
+// The dotenv files given by --env-file whose variables are added to the
+// command's environment.
+type envFiles struct {
+	paths []string
+
+	// The absolute paths of the files so we can recognize changes to them.
+	abs map[string]bool
+}
+
+// Creates the envFiles for the files at the given paths.
+func newEnvFiles(paths []string) *envFiles {
+	e := &envFiles{paths: paths, abs: map[string]bool{}}
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			e.abs[abs] = true
+		}
+	}
+	return e
+}
+
+// Reads the variables in the files. Later files override earlier ones.
+func (e *envFiles) load() ([]string, error) {
+	return envfile.Load(e.paths...)
+}
+
+// Indicates whether any of the given paths is one of the files.
+func (e *envFiles) changed(paths []string) bool {
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil && e.abs[abs] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package envfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	t.Run("Parses assignments, quotes and comments", func(t *testing.T) {
+		input := strings.Join([]string{
+			"# database",
+			"",
+			"DB_HOST=localhost",
+			"export DB_PORT = 5432",
+			"DB_PASS='p#ss \\n word'",
+			`GREETING="hello\n\"world\"" # comment`,
+			"EMPTY=",
+			"URL=http://example.com/#anchor # comment",
+		}, "\n")
+		expected := []string{
+			"DB_HOST=localhost",
+			"DB_PORT=5432",
+			"DB_PASS=p#ss \\n word",
+			"GREETING=hello\n\"world\"",
+			"EMPTY=",
+			"URL=http://example.com/#anchor",
+		}
+		actual, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("unexpected error from Parse(): %+v", err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Parse(); expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("Reports the line of an invalid assignment", func(t *testing.T) {
+		for _, input := range []string{"A=1\nnot an assignment", "A=1\nB=\"unterminated", "A=1\n1B=2"} {
+			if _, err := Parse(strings.NewReader(input)); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+				t.Errorf("Parse(%q); expected an error on line 2, got %v", input, err)
+			}
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	if err := os.WriteFile(base, []byte("A=1\nB=2\nA=3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("B=4\nC=5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"A=3", "B=4", "C=5"}
+	actual, err := Load(base, local)
+	if err != nil {
+		t.Fatalf("unexpected error from Load(): %+v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Load(); expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,191 @@
+// Package golist maps changed files to the Go packages they affect using the
+// package graph reported by go list.
+package golist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Package is a package of the module as go list describes it.
+type Package struct {
+	ImportPath string
+
+	// The absolute path of the package's directory.
+	Dir string
+
+	// The packages imported by the package, by its tests, and by its
+	// external tests.
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+
+	// Whether the package is only a dependency of the packages that were
+	// listed rather than one of them.
+	DepOnly bool
+}
+
+// A Graph is the packages of a module and the reverse dependencies between
+// them.
+type Graph struct {
+
+	// The packages of the module keyed by their directories.
+	packages map[string]*Package
+
+	// The packages that import each package, and those whose tests import
+	// it but the package itself doesn't, keyed by import path.
+	importers     map[string][]string
+	testImporters map[string][]string
+}
+
+// Load lists the packages of the module in dir with go list.
+func Load(dir string) (*Graph, error) {
+	cmd := exec.Command("go", "list", "-e", "-deps", "-json", "./...")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("go list failed: %s", msg)
+		}
+		return nil, fmt.Errorf("go list failed: %v", err)
+	}
+	packages := []*Package{}
+	decoder := json.NewDecoder(&stdout)
+	for {
+		var p Package
+		if err := decoder.Decode(&p); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read go list output: %v", err)
+		}
+		// The dependencies outside of the module don't change when we do.
+		if !p.DepOnly {
+			packages = append(packages, &p)
+		}
+	}
+	return NewGraph(packages), nil
+}
+
+// NewGraph creates a Graph of the given packages.
+func NewGraph(packages []*Package) *Graph {
+	g := &Graph{
+		packages:      map[string]*Package{},
+		importers:     map[string][]string{},
+		testImporters: map[string][]string{},
+	}
+	for _, p := range packages {
+		g.packages[filepath.Clean(p.Dir)] = p
+		seen := map[string]bool{}
+		for _, imported := range p.Imports {
+			if !seen[imported] {
+				seen[imported] = true
+				g.importers[imported] = append(g.importers[imported], p.ImportPath)
+			}
+		}
+		for _, imports := range [][]string{p.TestImports, p.XTestImports} {
+			for _, imported := range imports {
+				// An external test package imports the package it tests.
+				if imported == p.ImportPath || seen[imported] {
+					continue
+				}
+				seen[imported] = true
+				g.testImporters[imported] = append(g.testImporters[imported], p.ImportPath)
+			}
+		}
+	}
+	return g
+}
+
+// Affected returns the import paths of the packages whose tests could be
+// affected by changes to the given absolute paths, in lexical order. A
+// changed .go file affects its package and, unless it's a test file, the
+// packages that depend on it. A package whose tests alone import an affected
+// package is affected but nothing else is through it. Any other file affects the package whose
+// directory it's in, like an embedded file or test data, and go.mod and
+// go.sum affect every package.
+func (g *Graph) Affected(paths []string) []string {
+	affected := map[string]bool{}
+	changed := []string{}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if name == "go.mod" || name == "go.sum" {
+			return g.All()
+		}
+		if strings.HasSuffix(name, ".go") {
+			p, ok := g.packages[filepath.Dir(path)]
+			if !ok {
+				continue
+			}
+			affected[p.ImportPath] = true
+			// Nothing else sees a package's tests.
+			if !strings.HasSuffix(name, "_test.go") {
+				changed = append(changed, p.ImportPath)
+			}
+			continue
+		}
+		if p, ok := g.packageOf(path); ok {
+			affected[p.ImportPath] = true
+			changed = append(changed, p.ImportPath)
+		}
+	}
+
+	// A package that's only affected by its tests can still be affected by
+	// a dependency so we track the packages we've propagated from apart.
+	propagated := map[string]bool{}
+	for len(changed) > 0 {
+		importPath := changed[0]
+		changed = changed[1:]
+		if propagated[importPath] {
+			continue
+		}
+		propagated[importPath] = true
+		for _, importer := range g.importers[importPath] {
+			affected[importer] = true
+			changed = append(changed, importer)
+		}
+		// Nothing else sees a package's tests so its importers aren't
+		// affected through them.
+		for _, importer := range g.testImporters[importPath] {
+			affected[importer] = true
+		}
+	}
+
+	result := make([]string, 0, len(affected))
+	for importPath := range affected {
+		result = append(result, importPath)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// All returns the import paths of all the packages in lexical order.
+func (g *Graph) All() []string {
+	result := make([]string, 0, len(g.packages))
+	for _, p := range g.packages {
+		result = append(result, p.ImportPath)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Finds the package in the nearest directory that contains path.
+func (g *Graph) packageOf(path string) (*Package, bool) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if p, ok := g.packages[dir]; ok {
+			return p, true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package golist
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGraph_Affected(t *testing.T) {
+
+	root := filepath.FromSlash("/src/app")
+	dir := func(rel string) string {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+	g := NewGraph([]*Package{
+		{ImportPath: "app", Dir: root, Imports: []string{"app/server", "fmt"}},
+		{ImportPath: "app/server", Dir: dir("server"), Imports: []string{"app/store"}},
+		{ImportPath: "app/store", Dir: dir("store"), Imports: []string{"database/sql"}},
+		{ImportPath: "app/testutil", Dir: dir("testutil")},
+		{ImportPath: "app/report", Dir: dir("report"), XTestImports: []string{"app/report", "app/testutil"}},
+		{ImportPath: "app/export", Dir: dir("export"), Imports: []string{"app/report"}},
+	})
+
+	tests := []struct {
+		name     string
+		paths    []string
+		expected []string
+	}{
+		{"A source file affects its package and its importers",
+			[]string{dir("store/store.go")}, []string{"app", "app/server", "app/store"}},
+		{"A test file affects only its package",
+			[]string{dir("store/store_test.go")}, []string{"app/store"}},
+		{"Test imports affect the test importer but not its importers",
+			[]string{dir("testutil/util.go")}, []string{"app/report", "app/testutil"}},
+		{"A test importer's own changes affect its importers",
+			[]string{dir("report/report.go")}, []string{"app/export", "app/report"}},
+		{"Test data affects the package it's in",
+			[]string{dir("server/testdata/golden.json")}, []string{"app", "app/server"}},
+		{"go.mod affects every package",
+			[]string{dir("go.mod")}, []string{"app", "app/export", "app/report", "app/server", "app/store", "app/testutil"}},
+		{"Files outside of the packages affect nothing",
+			[]string{filepath.FromSlash("/src/other/main.go")}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := g.Affected(test.paths); !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("Affected(%v); expected %v, got %v", test.paths, test.expected, actual)
+			}
+		})
+	}
+}
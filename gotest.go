@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/ttd2089/pocket/golist"
+	"github.com/ttd2089/pocket/watch"
+)
+
+// A goTester runs go test on the packages affected by the changes rather than
+// running a command.
+type goTester struct {
+
+	// The directory of the module.
+	dir string
+
+	// The flags for go test.
+	flags []string
+}
+
+// Returns the arguments to go test for every package in the module.
+func (g *goTester) allArgs() []string {
+	return g.argsFor([]string{"./..."})
+}
+
+// Returns the arguments to go test for the packages affected by changes to
+// the given paths, or false when they don't affect any. The package graph is
+// loaded again each time since the changes can move imports around. When it
+// can't be loaded, or the watcher overflowed and we don't know what changed,
+// every package is tested.
+func (g *goTester) args(paths []string, overflowed bool) ([]string, bool) {
+	if overflowed {
+		return g.allArgs(), true
+	}
+	graph, err := golist.Load(g.dir)
+	if err != nil {
+		logRecord(watch.LevelWarn, watch.RecordError, watch.Fields{"error": err.Error()},
+			"failed to load the package graph, testing every package: %v", err)
+		return g.allArgs(), true
+	}
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if p, err := filepath.Abs(path); err == nil {
+			abs = append(abs, p)
+		}
+	}
+	packages := graph.Affected(abs)
+	if len(packages) == 0 {
+		return nil, false
+	}
+	return g.argsFor(packages), true
+}
+
+// Returns the arguments to go test for the given packages.
+func (g *goTester) argsFor(packages []string) []string {
+	args := append([]string{"test"}, g.flags...)
+	return append(args, packages...)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttd2089/pocket/watch"
+)
+
+// The types of the Records pocket logs on top of those from the watch package.
+const (
+	// recordProcess is a change in the lifecycle of the command's process.
+	recordProcess watch.RecordType = "process"
+
+	// recordTrigger is a Changeset that restarted the command or was held
+	// while paused.
+	recordTrigger watch.RecordType = "trigger"
+)
+
+// The names of the log levels for --log-level.
+var logLevels = map[string]watch.Level{
+	"error": watch.LevelError,
+	"warn":  watch.LevelWarn,
+	"info":  watch.LevelInfo,
+	"debug": watch.LevelDebug,
+	"trace": watch.LevelTrace,
+}
+
+// A logger that writes the Records at or above a level as lines of text or
+// JSON objects. A JSON object has the time, level, type and msg of the Record
+// and its fields.
+type appLogger struct {
+	w     io.Writer
+	json  bool
+	level watch.Level
+
+	// The absolute path of the file being logged to, if any. Records about it
+	// are dropped since logging them would change it and log another.
+	file string
+
+	mu sync.Mutex
+}
+
+// Creates an appLogger that writes the Records at or above the given level to
+// w.
+func newAppLogger(w io.Writer, level watch.Level, json bool) *appLogger {
+	return &appLogger{w: w, json: json, level: level}
+}
+
+// Writes the formatted message as an info Record.
+func (l *appLogger) Printf(format string, v ...interface{}) {
+	l.LogRecord(watch.Record{
+		Type:    watch.RecordInfo,
+		Level:   watch.LevelInfo,
+		Message: strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"),
+	})
+}
+
+// Writes the Record if it's at or above the level.
+func (l *appLogger) LogRecord(r watch.Record) {
+	if r.Level > l.level || l.aboutFile(r) {
+		return
+	}
+	now := time.Now()
+	var line []byte
+	if l.json {
+		line = jsonLine(now, r)
+	} else {
+		line = textLine(now, r)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// Indicates whether the Record is about the file being logged to.
+func (l *appLogger) aboutFile(r watch.Record) bool {
+	if l.file == "" {
+		return false
+	}
+	path, ok := r.Fields["path"].(string)
+	if !ok {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && abs == l.file
+}
+
+// Formats a Record as a line of text. Warnings and errors are prefixed with
+// their level.
+func textLine(now time.Time, r watch.Record) []byte {
+	var b strings.Builder
+	b.WriteString(now.Format("2006/01/02 15:04:05 "))
+	if r.Level <= watch.LevelWarn {
+		b.WriteString(r.Level.String())
+		b.WriteString(": ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+// Formats a Record as a line of JSON.
+func jsonLine(now time.Time, r watch.Record) []byte {
+	object := make(map[string]interface{}, len(r.Fields)+4)
+	for k, v := range r.Fields {
+		object[k] = v
+	}
+	object["time"] = now.Format(time.RFC3339Nano)
+	object["level"] = r.Level.String()
+	object["type"] = r.Type
+	object["msg"] = r.Message
+	line, err := json.Marshal(object)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{}{
+			"time":  object["time"],
+			"level": watch.LevelError.String(),
+			"type":  watch.RecordError,
+			"msg":   fmt.Sprintf("failed to encode %s record: %v", r.Type, err),
+		})
+	}
+	return append(line, '\n')
+}
+
+// Creates a Filter that filters out the events for the log file at the given
+// absolute path, if any, so that logging doesn't trigger the command.
+func isLogFile(file string) watch.Filter {
+	return func(event watch.FsEvent) (bool, error) {
+		if file == "" {
+			return false, nil
+		}
+		abs, err := filepath.Abs(event.Path)
+		return err == nil && abs == file, nil
+	}
+}
+
+// Logs a Record to the application logger.
+func logRecord(level watch.Level, t watch.RecordType, fields watch.Fields, format string, v ...interface{}) {
+	logger.LogRecord(watch.Record{
+		Type:    t,
+		Level:   level,
+		Message: fmt.Sprintf(format, v...),
+		Fields:  fields,
+	})
+}
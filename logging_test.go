@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttd2089/pocket/watch"
+)
+
+func Test_textLine(t *testing.T) {
+
+	now := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		level    watch.Level
+		expected string
+	}{
+		{name: "Errors are prefixed with their level", level: watch.LevelError, expected: "2024/03/04 05:06:07 error: message\n"},
+		{name: "Warnings are prefixed with their level", level: watch.LevelWarn, expected: "2024/03/04 05:06:07 warn: message\n"},
+		{name: "Info isn't prefixed", level: watch.LevelInfo, expected: "2024/03/04 05:06:07 message\n"},
+		{name: "Debug isn't prefixed", level: watch.LevelDebug, expected: "2024/03/04 05:06:07 message\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := watch.Record{Type: watch.RecordInfo, Level: test.level, Message: "message"}
+			if actual := string(textLine(now, r)); actual != test.expected {
+				t.Errorf("textLine(); expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_jsonLine(t *testing.T) {
+
+	now := time.Date(2024, 3, 4, 5, 6, 7, 8, time.UTC)
+
+	decode := func(t *testing.T, line []byte) map[string]interface{} {
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			t.Errorf("expected the line to end with a newline, got %q", line)
+		}
+		object := map[string]interface{}{}
+		if err := json.Unmarshal(line, &object); err != nil {
+			t.Fatalf("expected a JSON object, got %q: %v", line, err)
+		}
+		return object
+	}
+
+	t.Run("Writes the Record and its fields", func(t *testing.T) {
+		object := decode(t, jsonLine(now, watch.Record{
+			Type:    recordTrigger,
+			Level:   watch.LevelInfo,
+			Message: "restarting",
+			Fields:  watch.Fields{"paths": []string{"main.go"}, "overflowed": false},
+		}))
+		expected := map[string]interface{}{
+			"time":       "2024-03-04T05:06:07.000000008Z",
+			"level":      "info",
+			"type":       "trigger",
+			"msg":        "restarting",
+			"paths":      []interface{}{"main.go"},
+			"overflowed": false,
+		}
+		for k, v := range expected {
+			if actual, ok := object[k]; !ok || !equalJSON(actual, v) {
+				t.Errorf("expected %s to be %v, got %v", k, v, actual)
+			}
+		}
+		if len(object) != len(expected) {
+			t.Errorf("expected %d keys, got %v", len(expected), object)
+		}
+	})
+
+	t.Run("The Record's keys win over fields with the same names", func(t *testing.T) {
+		object := decode(t, jsonLine(now, watch.Record{
+			Type:    watch.RecordInfo,
+			Level:   watch.LevelWarn,
+			Message: "message",
+			Fields:  watch.Fields{"msg": "field", "level": "field"},
+		}))
+		if object["msg"] != "message" || object["level"] != "warn" {
+			t.Errorf("expected the Record's msg and level, got %v", object)
+		}
+	})
+
+	t.Run("Writes an error Record when the fields can't be encoded", func(t *testing.T) {
+		object := decode(t, jsonLine(now, watch.Record{
+			Type:    recordProcess,
+			Level:   watch.LevelInfo,
+			Message: "message",
+			Fields:  watch.Fields{"bad": func() {}},
+		}))
+		if object["level"] != "error" || object["type"] != string(watch.RecordError) {
+			t.Errorf("expected an error Record, got %v", object)
+		}
+		if msg, _ := object["msg"].(string); !strings.Contains(msg, "failed to encode process record") {
+			t.Errorf("expected a message about the encoding, got %q", msg)
+		}
+	})
+}
+
+func Test_appLogger_LogRecord(t *testing.T) {
+
+	t.Run("Writes text lines", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		l := newAppLogger(out, watch.LevelInfo, false)
+		l.Printf("hello %s\n", "world")
+		if !strings.HasSuffix(out.String(), " hello world\n") || strings.Count(out.String(), "\n") != 1 {
+			t.Errorf("expected a line ending with %q, got %q", " hello world\n", out.String())
+		}
+	})
+
+	t.Run("Writes JSON lines", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		l := newAppLogger(out, watch.LevelInfo, true)
+		l.Printf("hello")
+		object := map[string]interface{}{}
+		if err := json.Unmarshal(out.Bytes(), &object); err != nil {
+			t.Fatalf("expected a JSON object, got %q: %v", out.String(), err)
+		}
+		if object["msg"] != "hello" || object["type"] != string(watch.RecordInfo) || object["level"] != "info" {
+			t.Errorf("expected an info Record, got %v", object)
+		}
+	})
+
+	t.Run("Drops the Records below the level", func(t *testing.T) {
+		tests := []struct {
+			level    watch.Level
+			expected []string
+		}{
+			{level: watch.LevelError, expected: []string{"error"}},
+			{level: watch.LevelWarn, expected: []string{"error", "warn"}},
+			{level: watch.LevelInfo, expected: []string{"error", "warn", "info"}},
+			{level: watch.LevelTrace, expected: []string{"error", "warn", "info", "debug", "trace"}},
+		}
+		for _, test := range tests {
+			out := &bytes.Buffer{}
+			l := newAppLogger(out, test.level, true)
+			for _, level := range []watch.Level{watch.LevelError, watch.LevelWarn, watch.LevelInfo, watch.LevelDebug, watch.LevelTrace} {
+				l.LogRecord(watch.Record{Type: watch.RecordInfo, Level: level, Message: level.String()})
+			}
+			logged := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				object := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(line), &object); err == nil {
+					logged = append(logged, object["msg"].(string))
+				}
+			}
+			if strings.Join(logged, " ") != strings.Join(test.expected, " ") {
+				t.Errorf("at level %v; expected %v, got %v", test.level, test.expected, logged)
+			}
+		}
+	})
+
+	t.Run("Drops the Records about the log file", func(t *testing.T) {
+		dir := t.TempDir()
+		out := &bytes.Buffer{}
+		l := newAppLogger(out, watch.LevelTrace, false)
+		l.file = filepath.Join(dir, "pocket.log")
+		l.LogRecord(watch.Record{Type: watch.RecordWatch, Level: watch.LevelDebug, Message: "log file", Fields: watch.Fields{"path": l.file}})
+		l.LogRecord(watch.Record{Type: watch.RecordWatch, Level: watch.LevelDebug, Message: "other file", Fields: watch.Fields{"path": filepath.Join(dir, "main.go")}})
+		l.LogRecord(watch.Record{Type: watch.RecordInfo, Level: watch.LevelInfo, Message: "no path"})
+		if strings.Contains(out.String(), "log file") || !strings.Contains(out.String(), "other file") || !strings.Contains(out.String(), "no path") {
+			t.Errorf("expected only the Records that aren't about the log file, got %q", out.String())
+		}
+	})
+}
+
+func Test_isLogFile(t *testing.T) {
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pocket.log")
+
+	tests := []struct {
+		name     string
+		file     string
+		path     string
+		expected bool
+	}{
+		{name: "Filters the log file", file: file, path: file, expected: true},
+		{name: "Filters the log file by a path that isn't clean", file: file, path: strings.Join([]string{dir, "sub", "..", "pocket.log"}, string(filepath.Separator)), expected: true},
+		{name: "Doesn't filter other files", file: file, path: filepath.Join(dir, "main.go")},
+		{name: "Doesn't filter anything without a log file", path: file},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := isLogFile(test.file)(watch.FsEvent{Path: test.path, Type: watch.Write})
+			if err != nil {
+				t.Fatalf("unexpected error from the Filter: %+v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// Compares decoded JSON values.
+func equalJSON(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
@@ -1,26 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/pborman/getopt/v2"
+	"github.com/ttd2089/pocket/supervise"
+	"github.com/ttd2089/pocket/watch"
 )
 
 var productVersion = "0.0.0"
 
-var logger *log.Logger
+var logger watch.RecordLogger
 
 func init() {
 
-	logger = log.New(ioutil.Discard, "", log.LstdFlags)
-
-	initGitignore()
+	logger = newAppLogger(os.Stderr, watch.LevelWarn, false)
 }
 
 func main() {
@@ -32,13 +35,41 @@ func main() {
 		cli.PrintUsage(w)
 		fmt.Fprintf(w, "<cmd>               the command to run on file changes\n")
 		fmt.Fprintf(w, "<cmd-args>          the arguments for <cmd>\n")
+		fmt.Fprintf(w, "\n<cmd> runs with POCKET=1, POCKET_RUN, POCKET_TRIGGER, POCKET_PARENT_PID and, with the control API,\n")
+		fmt.Fprintf(w, "POCKET_CONTROL_SOCKET or POCKET_CONTROL_ADDR in its environment.\n")
+		fmt.Fprintf(w, "\nPOST requests to the control API need an X-Pocket header or a JSON Content-Type.\n")
+		fmt.Fprintf(w, "\nWith --go-test there's no <cmd> and any arguments after -- are passed to go test.\n")
+		fmt.Fprintf(w, "\nRun pocket [options] explain <path>... to show whether changes to the paths would run <cmd> and why.\n")
+		fmt.Fprintf(w, "\nWhen stdin is a terminal press ? while pocket runs to list the keyboard controls.\n")
+		fmt.Fprintf(w, "Send SIGUSR1 to hold changes while paused and SIGUSR2 to resume and catch up.\n")
 	}
 	cli.SetUsage(func() { usage(os.Stderr) })
 
+	attribFlag := cli.BoolLong("attrib", 0, "also run on changes to permissions and other file attributes")
 	chdirOpt := cli.StringLong("chdir", 'C', "", "the directory to run in", "<dir>")
+	controlOpt := cli.StringLong("control", 0, "", "serve the control API on a Unix socket at <path>", "<path>")
+	controlAddrOpt := cli.StringLong("control-addr", 0, "", "serve the control API over HTTP on a loopback address", "<host:port>")
+	envFileOpt := cli.ListLong("env-file", 0, "load variables for <cmd> from a dotenv file and restart when it changes, relative to --chdir; may be repeated", "<path>")
+	followSymlinksFlag := cli.BoolLong("follow-symlinks", 0, "watch the targets of symlinked directories")
+	goTestFlag := cli.BoolLong("go-test", 0, "run go test on the packages affected by each change instead of a command")
 	helpFlag := cli.BoolLong("help", 'h', "display help")
-	logFlag := cli.BoolLong("log", 'L', "write application logs to stderr")
+	listWatchedFlag := cli.BoolLong("list-watched", 0, "print the directories that would be watched and the patterns in effect, then exit")
+	notifyOpt := cli.EnumLong("notify", 0, []string{notifyNone, notifyOSC9, notifyOSC777, notifyBell}, notifyNone,
+		"notify through the terminal when a run fails or recovers", "none|osc9|osc777|bell")
+	logFlag := cli.BoolLong("log", 'L', "write debug logs; the same as --log-level=debug")
+	logFileOpt := cli.StringLong("log-file", 0, "", "write application logs to <path> rather than stderr", "<path>")
+	logFormatOpt := cli.EnumLong("log-format", 0, []string{"text", "json"}, "text", "the format of the application logs", "text|json")
+	logLevelOpt := cli.EnumLong("log-level", 0, []string{"error", "warn", "info", "debug", "trace"}, "warn",
+		"the least important application logs to write", "error|warn|info|debug|trace")
+	pollFlag := cli.BoolLong("poll", 0, "poll for changes instead of using file system notifications")
+	pollFallbackFlag := cli.BoolLong("poll-fallback", 0, "poll the directories beyond the system's notification watch limit")
+	pollIntervalOpt := cli.DurationLong("poll-interval", 0, watch.DefaultPollInterval, "the interval between polls", "<duration>")
+	rawEventsFlag := cli.BoolLong("raw-events", 0, "report editors' temporary files and atomic saves as they happen rather than as writes")
+	titleFlag := cli.BoolLong("title", 0, "show the command's state in the terminal or tmux window title")
+	symlinkPolicyOpt := cli.EnumLong("symlink-policy", 0, []string{"confine", "allow"}, "confine",
+		"with --follow-symlinks, whether to follow links to targets outside of the watched roots", "confine|allow")
 	versionFlag := cli.BoolLong("version", 'v', "display product version")
+	watchOpt := cli.ListLong("watch", 'w', "a directory to watch recursively or a file to watch, relative to --chdir; may be repeated (default .)", "<path>")
 
 	cli.Parse(os.Args)
 
@@ -54,89 +85,348 @@ func main() {
 		return
 	}
 
-	if len(args) == 0 {
+	if len(args) == 0 && !*listWatchedFlag && !*goTestFlag {
 		usage(os.Stdout)
 		return
 	}
 
+	// The log file is relative to where we were run rather than --chdir.
+	level := logLevels[*logLevelOpt]
+	if *logFlag && !cli.IsSet("log-level") {
+		level = watch.LevelDebug
+	}
+	appLog := newAppLogger(os.Stderr, level, *logFormatOpt == "json")
+	if *logFileOpt != "" {
+		f, err := os.OpenFile(*logFileOpt, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			die(fmt.Sprintf("failed to open log file: %v", err))
+		}
+		if appLog.file, err = filepath.Abs(*logFileOpt); err != nil {
+			die(fmt.Sprintf("failed to open log file: %v", err))
+		}
+		appLog.w = f
+	}
+	logger = appLog
+
 	if *chdirOpt != "" {
 		if err := os.Chdir(*chdirOpt); err != nil {
 			die(fmt.Sprintf("failed to cd to %s: %v", *chdirOpt, err))
 		}
 	}
 
-	if *logFlag {
-		logger = log.New(os.Stderr, "", log.LstdFlags)
+	paths := *watchOpt
+	if len(paths) == 0 {
+		paths = []string{"."}
 	}
+	// The env files are watched by name so they're seen even when they're
+	// gitignored.
+	paths = append(paths, *envFileOpt...)
 
-	run(args[0], args[1:]...)
-}
+	watchOpts := []watch.Option{
+		watch.WithFilter(isLogFile(appLog.file)),
+		watch.WithGitIgnore(),
+		watch.WithPollInterval(*pollIntervalOpt),
+		watch.WithLogger(logger),
+	}
+	if *pollFlag {
+		watchOpts = append(watchOpts, watch.WithPolling())
+	}
+	if *pollFallbackFlag {
+		watchOpts = append(watchOpts, watch.WithPollFallback())
+	}
+	if *attribFlag {
+		watchOpts = append(watchOpts, watch.WithEvents(watch.DefaultEvents|watch.Attrib))
+	}
+	if *rawEventsFlag {
+		watchOpts = append(watchOpts, watch.WithRawEvents())
+	}
+	if *followSymlinksFlag {
+		policy := watch.SymlinkConfine
+		if *symlinkPolicyOpt == "allow" {
+			policy = watch.SymlinkAllow
+		}
+		watchOpts = append(watchOpts, watch.WithSymlinks(policy))
+	}
+
+	if *listWatchedFlag {
+		listWatched(paths, watchOpts, appLog.file, !*rawEventsFlag)
+		return
+	}
 
-// Runs the command and re-starts it on file changes.
-func run(cmd string, args ...string) {
+	if len(args) > 0 && args[0] == "explain" {
+		if len(args) == 1 {
+			die("explain needs at least one path")
+		}
+		explain(paths, watchOpts, args[1:])
+		return
+	}
+
+	if *controlOpt != "" && *controlAddrOpt != "" {
+		die("--control and --control-addr can't be used together")
+	}
 
-	filter := func(_ FsEvent) (bool, error) {
-		return false, nil
+	c := runConfig{
+		paths:         paths,
+		watchOpts:     watchOpts,
+		controlSocket: *controlOpt,
+		controlAddr:   *controlAddrOpt,
 	}
+	if len(*envFileOpt) > 0 {
+		c.env = newEnvFiles(*envFileOpt)
+	}
+	if (*titleFlag || *notifyOpt != notifyNone) && !isTerminal(int(os.Stderr.Fd())) {
+		// The sequences would only garble whatever stderr goes to.
+		logRecord(watch.LevelWarn, watch.RecordInfo, nil, "--title and --notify need stderr to be a terminal")
+	} else if *titleFlag || *notifyOpt != notifyNone {
+		c.term = &termStatus{
+			w:      os.Stderr,
+			title:  *titleFlag,
+			notify: *notifyOpt,
+			tmux:   os.Getenv("TMUX") != "",
 
-	if GitIgnoreSupported {
-		logger.Printf("using .gitignore filter")
-		filter = func(event FsEvent) (bool, error) {
-			return GitIgnored(event.Path)
+			recoveryDelay: defaultRecoveryDelay,
+		}
+	}
+	if *goTestFlag {
+		// The module is where go list and go test run; we test all of it to
+		// begin with.
+		c.goTest = &goTester{dir: ".", flags: args}
+		if c.term != nil {
+			c.term.label = "go test"
 		}
+		run(c, "go", c.goTest.allArgs()...)
+		return
+	}
+	if c.term != nil {
+		c.term.label = filepath.Base(args[0])
 	}
+	run(c, args[0], args[1:]...)
+}
+
+// The settings for a run beyond the command.
+type runConfig struct {
+
+	// The paths to watch and the options to watch them with.
+	paths     []string
+	watchOpts []watch.Option
+
+	// Where to serve the control API, if anywhere.
+	controlSocket string
+	controlAddr   string
+
+	// Set to test the packages affected by each change with go test.
+	goTest *goTester
+
+	// The files to load the command's environment from, possibly nil.
+	env *envFiles
 
-	watcher, err := NewWatcher(filter)
+	// Shows the command's state in the terminal, possibly nil.
+	term *termStatus
+}
+
+// Runs the command and re-starts it on changes to the configured paths.
+func run(c runConfig, cmd string, args ...string) {
+
+	dw, err := watch.New(c.paths, c.watchOpts...)
 	if err != nil {
+		die(watchErrorMessage(err))
+	}
+
+	// The child is in its own process group so it doesn't see the terminal's
+	// interrupt; stop it ourselves on the way out.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	s := &session{
+		dw:      dw,
+		quit:    cancel,
+		out:     os.Stderr,
+		goTest:  c.goTest,
+		env:     c.env,
+		term:    c.term,
+		gitDirs: gitDirs(c.paths),
+
+		gitPollInterval: defaultGitPollInterval,
+		gitSettleTime:   defaultGitSettleTime,
+
+		gitRemindInterval: defaultGitRemindInterval,
+	}
+	runner := supervise.New(cmd, args, supervise.WithEnvFunc(s.runEnv))
+	s.runner = runner
+	if c.env != nil {
+		env, err := c.env.load()
+		if err != nil {
+			die(fmt.Sprintf("failed to load the env files: %v", err))
+		}
+		runner.SetEnv(env)
+	}
+	go s.watchProcess(runner.Events())
+
+	var control *http.Server
+	if c.controlSocket != "" || c.controlAddr != "" {
+		l, err := listenControl(c.controlSocket, c.controlAddr)
+		if err != nil {
+			die(fmt.Sprintf("failed to serve the control API: %v", err))
+		}
+		logRecord(watch.LevelInfo, watch.RecordInfo, watch.Fields{"addr": l.Addr().String()},
+			"serving the control API on %s", l.Addr())
+		if c.controlSocket != "" {
+			// The command could change directories.
+			if s.controlSocket, err = filepath.Abs(c.controlSocket); err != nil {
+				s.controlSocket = c.controlSocket
+			}
+		} else {
+			s.controlAddr = l.Addr().String()
+		}
+		control = &http.Server{Handler: s.controlHandler()}
+		go func() {
+			if err := control.Serve(l); err != nil && err != http.ErrServerClosed {
+				logRecord(watch.LevelError, watch.RecordError, watch.Fields{"error": err.Error()}, "control API error: %v", err)
+			}
+		}()
+	}
+
+	if err := runner.Start(); err != nil {
 		die(err.Error())
 	}
 
-	proc, err := startProcess(cmd, args)
+	go s.handleSignals(ctx)
+	restoreTerminal := s.startKeys()
+	err = dw.Watch(ctx, func(changes watch.Changeset) error {
+		return s.handle(ctx, changes)
+	})
+	restoreTerminal()
+	if control != nil {
+		// Closing the listener removes the socket.
+		control.Close()
+	}
+	if stopErr := runner.Stop(); stopErr != nil {
+		logRecord(watch.LevelError, watch.RecordError, watch.Fields{"error": stopErr.Error()}, "failed to stop process: %v", stopErr)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		die(watchErrorMessage(err))
+	}
+}
+
+// Prints the directories that would be watched for the given paths, how many
+// there are, and the patterns that changes are ignored by.
+func listWatched(paths []string, watchOpts []watch.Option, logFile string, normalize bool) {
+	dw, err := watch.NewDryRun(paths, watchOpts...)
 	if err != nil {
-		die(err.Error())
+		die(watchErrorMessage(err))
+	}
+	dirs, err := dw.Plan()
+	if err != nil {
+		die(fmt.Sprintf("failed to walk the watched paths: %v", err))
+	}
+	for _, dir := range dirs {
+		fmt.Println(dir)
+	}
+	fmt.Printf("%d directories would be watched\n", len(dirs))
+
+	fmt.Printf("\nPatterns in effect:\n")
+	if logFile != "" {
+		fmt.Printf("  %-12s %s (the log file)\n", watch.ReasonFilter, logFile)
+	}
+	if watch.GitIgnoreSupported() {
+		roots := []string{}
+		for _, path := range paths {
+			if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+				roots = append(roots, path)
+			}
+		}
+		rules, err := watch.GitIgnorePatterns(roots, dirs)
+		if err != nil {
+			die(fmt.Sprintf("failed to read the gitignore patterns: %v", err))
+		}
+		for _, rule := range rules {
+			fmt.Printf("  %-12s %s:%d: %s\n", watch.ReasonGitIgnore, rule.Source, rule.Line, rule.Pattern)
+		}
+	} else {
+		fmt.Printf("  %-12s git was not found so nothing is gitignored\n", watch.ReasonGitIgnore)
+	}
+	if normalize {
+		fmt.Printf("  %-12s %s\n", watch.ReasonEditorTemp, strings.Join(watch.EditorTempPatterns(), " "))
 	}
+}
 
-	handle := func(e WatcherEvent) error {
-		if e.Error != nil {
-			logger.Printf("watcher error: %v\n", e.Error)
-			return nil
+// Prints whether changes to the given paths would run the command and each
+// step of the decision.
+func explain(paths []string, watchOpts []watch.Option, explained []string) {
+	dw, err := watch.NewDryRun(paths, watchOpts...)
+	if err != nil {
+		die(watchErrorMessage(err))
+	}
+	for i, path := range explained {
+		e, err := dw.Explain(path)
+		if err != nil {
+			die(fmt.Sprintf("failed to explain %s: %v", path, err))
 		}
-		if err = stopProcess(proc); err != nil {
-			return err
+		if i > 0 {
+			fmt.Println()
 		}
-		if proc, err = startProcess(cmd, args); err != nil {
-			return err
+		if e.Reported {
+			fmt.Printf("%s: would trigger a run\n", path)
+		} else {
+			fmt.Printf("%s: would not trigger a run\n", path)
 		}
+		for _, step := range e.Steps {
+			result := "pass"
+			if !step.Passed {
+				result = "FAIL"
+			}
+			fmt.Printf("  %s  %-12s %s\n", result, step.Check, step.Detail)
+		}
+	}
+}
+
+// Finds the git directories of the repositories the given paths are in.
+func gitDirs(paths []string) []string {
+	if !watch.GitIgnoreSupported() {
 		return nil
 	}
+	dirs := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			path = filepath.Dir(path)
+		}
+		if dir, ok := watch.GitDir(path); ok && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
 
-	if err := Watch(".", watcher, handle); err != nil {
-		die(err.Error())
+// Describes an error from watching, explaining how to raise the limit when
+// the system ran out of watches.
+func watchErrorMessage(err error) string {
+	var limitErr *watch.WatchLimitError
+	if !errors.As(err, &limitErr) {
+		return err.Error()
+	}
+	var b strings.Builder
+	b.WriteString(limitErr.Error())
+	if limitErr.LimitName != "" {
+		// The limit is shared by every process of the user so leave as much
+		// room as we need on top of what's there already.
+		suggested := limitErr.Limit + limitErr.Needed
+		if limitErr.Needed == 0 {
+			suggested = limitErr.Limit * 2
+		}
+		fmt.Fprintf(&b, "\nRaise the limit with:\n    sudo sysctl %s=%d",
+			limitErr.LimitName, suggested)
+		b.WriteString("\nor rerun with --poll-fallback to poll the directories beyond it.")
+	} else {
+		b.WriteString("\nRerun with --poll-fallback to poll the directories beyond the limit.")
 	}
+	return b.String()
 }
 
 // Write the given message to stderr and exit the process. This message
 // written whether logging is enabled or not.
 func die(message string) {
-	os.Stderr.WriteString(message)
+	os.Stderr.WriteString(message + "\n")
 	os.Exit(1)
 }
-
-// Starts a process using the given cmd and args.
-func startProcess(cmd string, args []string) (*exec.Cmd, error) {
-	proc := newCommand(cmd, args...)
-	proc.Stderr = os.Stderr
-	proc.Stdout = os.Stdout
-	if err := proc.Start(); err != nil {
-		tokens := append([]string{cmd}, args...)
-		for i, v := range tokens {
-			v = strings.ReplaceAll(v, "\"", "\\\"")
-			if strings.Contains(v, " ") {
-				v = fmt.Sprintf("\"%s\"", v)
-			}
-			tokens[i] = v
-		}
-		return nil, fmt.Errorf("failed to run '%s': %v", strings.Join(tokens, " "), err)
-	}
-	return proc, nil
-}
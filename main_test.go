@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/ttd2089/pocket/watch"
+)
+
+func Test_watchErrorMessage(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "Other errors are reported as they are",
+			err:      errors.New("watch error"),
+			expected: "watch error",
+		},
+		{
+			name: "Suggests a limit that leaves room for the directories",
+			err:  &watch.WatchLimitError{Needed: 9000, LimitName: "fs.inotify.max_user_watches", Limit: 8192, Err: syscall.ENOSPC},
+			expected: "watch limit reached: 9000 directories need watches but fs.inotify.max_user_watches is 8192: no space left on device\n" +
+				"Raise the limit with:\n    sudo sysctl fs.inotify.max_user_watches=17192\n" +
+				"or rerun with --poll-fallback to poll the directories beyond it.",
+		},
+		{
+			name: "Suggests doubling the limit when the directories are unknown",
+			err:  &watch.WatchLimitError{LimitName: "fs.inotify.max_user_instances", Limit: 128, Err: syscall.EMFILE},
+			expected: "watch limit reached: fs.inotify.max_user_instances is 128: too many open files\n" +
+				"Raise the limit with:\n    sudo sysctl fs.inotify.max_user_instances=256\n" +
+				"or rerun with --poll-fallback to poll the directories beyond it.",
+		},
+		{
+			name: "Suggests --poll-fallback when the limit is unknown",
+			err:  &watch.WatchLimitError{Needed: 9000, Err: syscall.ENOSPC},
+			expected: "watch limit reached watching 9000 directories: no space left on device\n" +
+				"Rerun with --poll-fallback to poll the directories beyond the limit.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := watchErrorMessage(test.err); actual != test.expected {
+				t.Errorf("watchErrorMessage(); expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ttd2089/pocket/supervise"
+	"github.com/ttd2089/pocket/watch"
+)
+
+// The help for the keyboard controls.
+const keyHelp = `keys:
+  r  restart the command
+  s  stop the command
+  c  clear the screen
+  p  pause or resume watching
+  q  quit
+  ?  show this help
+`
+
+// The number of events a session remembers.
+const historySize int = 100
+
+// How often a session checks whether a git operation has finished, and how
+// long the repository must stay free of operations before it's settled. The
+// pause covers the gaps between the steps of a rebase.
+const (
+	defaultGitPollInterval time.Duration = 250 * time.Millisecond
+	defaultGitSettleTime   time.Duration = 1 * time.Second
+)
+
+// How often a session reminds the user that changes are still held for a git
+// operation, which could be a merge that's left unfinished for a while.
+const defaultGitRemindInterval time.Duration = 30 * time.Second
+
+// The parts of a supervise.Runner a session uses.
+type processRunner interface {
+	Start() error
+	Stop() error
+	Restart() error
+	Status() supervise.Status
+	SetArgs(args []string)
+	SetEnv(env []string)
+}
+
+// A session ties the watcher to the supervised command and takes commands
+// from the keyboard and the control API.
+type session struct {
+	runner processRunner
+	dw     *watch.DirWatcher
+
+	// Ends the session.
+	quit context.CancelFunc
+
+	// Where notices for the user are written.
+	out io.Writer
+
+	// When set the session tests the packages affected by each change
+	// rather than rerunning the command as it is.
+	goTest *goTester
+
+	// The files the command's environment is loaded from, possibly nil.
+	env *envFiles
+
+	// Shows the command's state in the terminal, possibly nil.
+	term *termStatus
+
+	// Where the control API is served, if anywhere, for the command to find
+	// it.
+	controlSocket string
+	controlAddr   string
+
+	// The git directories of the repositories the watched paths are in.
+	// Changes are held while a git operation is in progress in any of them.
+	gitDirs []string
+
+	// How often to check whether a git operation has finished, and how long
+	// the repositories must stay free of them before the held changes run.
+	gitPollInterval time.Duration
+	gitSettleTime   time.Duration
+
+	// How often to remind the user that changes are held while a git
+	// operation is in progress.
+	gitRemindInterval time.Duration
+
+	// Guards the fields below.
+	mu sync.Mutex
+
+	// Whether changes are being held rather than triggering restarts.
+	paused bool
+
+	// The paths that changed while paused, and whether the watcher
+	// overflowed while paused.
+	missed         map[string]bool
+	missedOverflow bool
+
+	// The paths that changed while a git operation was in progress, or nil
+	// when no operation is being waited for.
+	gitHeld         map[string]bool
+	gitHeldOverflow bool
+
+	// The most recent events, oldest first.
+	history []sessionEvent
+
+	// The path whose change is restarting the command, if a change is.
+	trigger string
+}
+
+// A sessionEvent is something that happened during a session.
+type sessionEvent struct {
+	Time time.Time `json:"time"`
+
+	// One of change, process, pause or resume.
+	Kind string `json:"kind"`
+
+	// The changed paths, and whether the change was held while paused or
+	// while a git operation was in progress.
+	Paths []string `json:"paths,omitempty"`
+	Held  bool     `json:"held,omitempty"`
+
+	// The lifecycle event of the command's process.
+	Process  string `json:"process,omitempty"`
+	Pid      int    `json:"pid,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// Handles the changes from a debounce window by restarting the command. Any
+// wait for a git operation to finish ends with ctx.
+func (s *session) handle(ctx context.Context, changes watch.Changeset) error {
+	for _, err := range changes.Errors {
+		logRecord(watch.LevelError, watch.RecordError, watch.Fields{"error": err.Error()}, "watcher error: %v", err)
+	}
+	if len(changes.Changes) == 0 && !changes.Overflowed {
+		return nil
+	}
+	s.mu.Lock()
+	paused := s.paused
+	if paused {
+		for _, path := range changes.Paths() {
+			s.missed[path] = true
+		}
+		s.missedOverflow = s.missedOverflow || changes.Overflowed
+	}
+	// Once we're waiting for an operation everything is held until the
+	// repository settles so the command runs once for the lot.
+	marker := ""
+	waiting := s.gitHeld != nil
+	if !paused && !waiting {
+		marker = s.gitOperation()
+	}
+	gitHeld := !paused && (waiting || marker != "")
+	if gitHeld {
+		if !waiting {
+			s.gitHeld = map[string]bool{}
+			s.gitHeldOverflow = false
+			go s.waitForGit(ctx)
+		}
+		for _, path := range changes.Paths() {
+			s.gitHeld[path] = true
+		}
+		s.gitHeldOverflow = s.gitHeldOverflow || changes.Overflowed
+	}
+	held := paused || gitHeld
+	s.record(sessionEvent{Kind: "change", Paths: changes.Paths(), Held: held})
+	s.mu.Unlock()
+	fields := watch.Fields{"paths": changes.Paths(), "overflowed": changes.Overflowed, "held": held}
+	if paused {
+		logRecord(watch.LevelInfo, recordTrigger, fields, "paused, holding changes: %v", changes.Paths())
+		return nil
+	}
+	if gitHeld {
+		if marker != "" {
+			fields["marker"] = marker
+			s.notify("git operation in progress (%s); holding changes until it finishes", marker)
+		}
+		logRecord(watch.LevelInfo, recordTrigger, fields, "git operation in progress, holding changes: %v", changes.Paths())
+		return nil
+	}
+	logRecord(watch.LevelInfo, recordTrigger, fields, "changed: %v", changes.Paths())
+	return s.restartFor(changes.Paths(), changes.Overflowed, false)
+}
+
+// Restarts the command for changes to the given paths. The environment is
+// reloaded first when the env files changed. In go test mode the command is
+// pointed at the affected packages, and isn't restarted when there are none
+// unless the restart was requested.
+func (s *session) restartFor(paths []string, overflowed bool, requested bool) error {
+	if s.env != nil && s.env.changed(paths) {
+		s.reloadEnv()
+		// The environment is seen by every package.
+		overflowed = true
+	}
+	if s.goTest != nil {
+		args, ok := s.goTest.args(paths, overflowed)
+		if !ok {
+			logRecord(watch.LevelInfo, watch.RecordInfo, watch.Fields{"paths": paths},
+				"no packages affected by %v", paths)
+			if !requested {
+				return nil
+			}
+		} else {
+			s.runner.SetArgs(args)
+		}
+	}
+	s.mu.Lock()
+	if len(paths) > 0 {
+		s.trigger = paths[0]
+	}
+	s.mu.Unlock()
+	return s.runner.Restart()
+}
+
+// Returns the variables that describe the run with the given number to the
+// command. POCKET_TRIGGER is empty for a run that wasn't triggered by a
+// change, and the control variables are empty without a control API, so that
+// none of them leak through from a pocket that's running this one.
+func (s *session) runEnv(run int) []string {
+	s.mu.Lock()
+	trigger := s.trigger
+	s.trigger = ""
+	s.mu.Unlock()
+	return []string{
+		"POCKET=1",
+		fmt.Sprintf("POCKET_RUN=%d", run),
+		"POCKET_TRIGGER=" + trigger,
+		fmt.Sprintf("POCKET_PARENT_PID=%d", os.Getpid()),
+		"POCKET_CONTROL_SOCKET=" + s.controlSocket,
+		"POCKET_CONTROL_ADDR=" + s.controlAddr,
+	}
+}
+
+// Loads the env files into the command's environment. When they can't be
+// loaded the command keeps the environment it had.
+func (s *session) reloadEnv() {
+	env, err := s.env.load()
+	if err != nil {
+		s.notify("failed to reload the env files, keeping the previous environment: %v", err)
+		logRecord(watch.LevelError, watch.RecordError, watch.Fields{"error": err.Error()}, "failed to reload the env files: %v", err)
+		return
+	}
+	s.runner.SetEnv(env)
+	logRecord(watch.LevelInfo, watch.RecordInfo, watch.Fields{"files": s.env.paths, "variables": len(env)},
+		"reloaded %d variables from %v", len(env), s.env.paths)
+}
+
+// Returns the keys of a set of paths in lexical order.
+func pathList(set map[string]bool) []string {
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Reads keys from r and runs the commands they're bound to until r is
+// exhausted.
+func (s *session) readKeys(r io.Reader) {
+	keys := bufio.NewReader(r)
+	for {
+		key, err := keys.ReadByte()
+		if err != nil {
+			return
+		}
+		s.command(key)
+	}
+}
+
+// Runs the command bound to a key.
+func (s *session) command(key byte) {
+	switch key {
+	case 'r':
+		logRecord(watch.LevelInfo, watch.RecordInfo, nil, "restart requested")
+		if err := s.restart(); err != nil {
+			s.notify("%v", err)
+		}
+	case 's':
+		logRecord(watch.LevelInfo, watch.RecordInfo, nil, "stop requested")
+		if err := s.runner.Stop(); err != nil {
+			s.notify("%v", err)
+		} else {
+			s.notify("command stopped")
+		}
+	case 'c':
+		fmt.Fprint(s.out, "\033[H\033[2J")
+	case 'p':
+		if s.isPaused() {
+			if err := s.resume(); err != nil {
+				s.notify("%v", err)
+			}
+		} else {
+			s.pause()
+		}
+	case 'q':
+		s.quit()
+	case '?':
+		fmt.Fprint(s.out, keyHelp)
+	}
+}
+
+// Restarts the command on request. Changes held for a git operation are let
+// through rather than waiting for it to finish, which could take a while when
+// a merge is left unfinished; the changes made after are held until it does.
+func (s *session) restart() error {
+	s.mu.Lock()
+	held, overflow := pathList(s.gitHeld), s.gitHeldOverflow
+	if s.gitHeld != nil {
+		s.gitHeld = map[string]bool{}
+		s.gitHeldOverflow = false
+	}
+	s.mu.Unlock()
+	if len(held) == 0 && !overflow {
+		return s.runner.Restart()
+	}
+	s.notify("restarting for %d paths held for the git operation", len(held))
+	return s.restartFor(held, overflow, true)
+}
+
+// Holds changes rather than restarting the command for them until resume is
+// called.
+func (s *session) pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused {
+		return
+	}
+	s.paused = true
+	s.missed = map[string]bool{}
+	s.missedOverflow = false
+	s.record(sessionEvent{Kind: "pause"})
+	s.notify("watching paused")
+}
+
+// Stops holding changes and restarts the command once if anything changed
+// while paused.
+func (s *session) resume() error {
+	s.mu.Lock()
+	if !s.paused {
+		s.mu.Unlock()
+		return nil
+	}
+	s.paused = false
+	missed := pathList(s.missed)
+	overflowed := s.missedOverflow
+	catchUp := len(missed) > 0 || overflowed
+	s.missed = nil
+	s.record(sessionEvent{Kind: "resume"})
+	s.mu.Unlock()
+
+	if !catchUp {
+		s.notify("watching resumed")
+		return nil
+	}
+	s.notify("watching resumed; %d paths changed while paused", len(missed))
+	return s.restartFor(missed, overflowed, false)
+}
+
+// Returns the marker of a git operation in progress in any of the session's
+// repositories, or "" when there's none.
+func (s *session) gitOperation() string {
+	for _, gitDir := range s.gitDirs {
+		if marker := watch.GitOperation(gitDir); marker != "" {
+			return marker
+		}
+	}
+	return ""
+}
+
+// Waits for the git operations in the session's repositories to finish and
+// then restarts the command once for the changes held in the meantime. When
+// the session was paused while waiting the changes are held for resume. It
+// reminds the user of the held changes while the operation lasts, and gives
+// up when ctx is done since the command is being stopped for good.
+func (s *session) waitForGit(ctx context.Context) {
+	ticker := time.NewTicker(s.gitPollInterval)
+	defer ticker.Stop()
+	settled := time.Time{}
+	reminded := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if marker := s.gitOperation(); marker != "" {
+			settled = time.Time{}
+			if time.Since(reminded) >= s.gitRemindInterval {
+				reminded = time.Now()
+				s.remindGitHeld(marker)
+			}
+			continue
+		}
+		if settled.IsZero() {
+			settled = time.Now()
+		}
+		if time.Since(settled) >= s.gitSettleTime {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	held, overflow := s.gitHeld, s.gitHeldOverflow
+	s.gitHeld = nil
+	paused := s.paused
+	if paused {
+		for path := range held {
+			s.missed[path] = true
+		}
+		s.missedOverflow = s.missedOverflow || overflow
+	}
+	s.mu.Unlock()
+
+	if paused {
+		s.notify("git operation finished; holding %d changed paths while paused", len(held))
+		return
+	}
+	// The held changes may have been let through by a restart already.
+	if len(held) == 0 && !overflow {
+		s.notify("git operation finished")
+		return
+	}
+	s.notify("git operation finished; %d paths changed", len(held))
+	if err := s.restartFor(pathList(held), overflow, false); err != nil {
+		logRecord(watch.LevelError, watch.RecordError, watch.Fields{"error": err.Error()}, "failed to restart process: %v", err)
+	}
+}
+
+// Tells the user that changes are still held for the git operation with the
+// given marker.
+func (s *session) remindGitHeld(marker string) {
+	s.mu.Lock()
+	held := len(s.gitHeld)
+	s.mu.Unlock()
+	logRecord(watch.LevelInfo, watch.RecordInfo, watch.Fields{"marker": marker, "held": held},
+		"git operation still in progress, holding %d changed paths", held)
+	s.notify("git operation still in progress (%s); holding %d changed paths, press r to restart with them", marker, held)
+}
+
+// Indicates whether the session is paused.
+func (s *session) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// Logs and records the lifecycle of the command's process.
+func (s *session) watchProcess(events <-chan supervise.Event) {
+	for event := range events {
+		if s.term != nil {
+			s.term.event(event)
+		}
+		e := sessionEvent{
+			Time:    event.Time,
+			Kind:    "process",
+			Process: event.Type.String(),
+			Pid:     event.Pid,
+		}
+		fields := watch.Fields{"event": event.Type.String(), "pid": event.Pid}
+		switch event.Type {
+		case supervise.Started:
+			logRecord(watch.LevelInfo, recordProcess, fields, "process %d %v", event.Pid, event.Type)
+		case supervise.Stopping:
+			logRecord(watch.LevelDebug, recordProcess, fields, "process %d %v", event.Pid, event.Type)
+		case supervise.StartFailed:
+			fields["error"] = event.Err.Error()
+			logRecord(watch.LevelError, recordProcess, fields, "%v", event.Err)
+		case supervise.Exited, supervise.Killed:
+			fields["exit_code"] = event.ExitCode
+			logRecord(watch.LevelInfo, recordProcess, fields, "process %d %v with code %d", event.Pid, event.Type, event.ExitCode)
+			exitCode := event.ExitCode
+			e.ExitCode = &exitCode
+		}
+		s.mu.Lock()
+		s.record(e)
+		s.mu.Unlock()
+	}
+}
+
+// Adds an event to the history, forgetting the oldest when it's full. The
+// caller must hold the lock.
+func (s *session) record(e sessionEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(s.history) == historySize {
+		s.history = append(s.history[:0], s.history[1:]...)
+	}
+	s.history = append(s.history, e)
+}
+
+// Returns up to limit of the most recent events, oldest first.
+func (s *session) recent(limit int) []sessionEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 || limit > len(s.history) {
+		limit = len(s.history)
+	}
+	return append([]sessionEvent{}, s.history[len(s.history)-limit:]...)
+}
+
+// Writes a notice for the user.
+func (s *session) notify(format string, v ...interface{}) {
+	fmt.Fprintf(s.out, "pocket: "+format+"\n", v...)
+}
+
+// Starts taking commands from the keyboard when stdin is a terminal. The
+// returned function restores the terminal.
+func (s *session) startKeys() func() {
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return func() {}
+	}
+	restore, err := makeCbreak(fd)
+	if err != nil {
+		logRecord(watch.LevelWarn, watch.RecordError, watch.Fields{"error": err.Error()}, "keyboard controls disabled: %v", err)
+		return func() {}
+	}
+	go s.readKeys(os.Stdin)
+	return restore
+}
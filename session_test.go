@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ttd2089/pocket/supervise"
+	"github.com/ttd2089/pocket/watch"
+)
+
+func init() {
+	// Keep the records the tests cause out of the test output.
+	logger = newAppLogger(io.Discard, watch.LevelError, false)
+}
+
+// A processRunner that records the calls made to it.
+type fakeRunner struct {
+	mu     sync.Mutex
+	calls  []string
+	args   []string
+	env    []string
+	status supervise.Status
+
+	// The error returned by Start, Stop and Restart.
+	err error
+}
+
+func (r *fakeRunner) call(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, name)
+	return r.err
+}
+
+func (r *fakeRunner) Start() error   { return r.call("start") }
+func (r *fakeRunner) Stop() error    { return r.call("stop") }
+func (r *fakeRunner) Restart() error { return r.call("restart") }
+
+func (r *fakeRunner) Status() supervise.Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *fakeRunner) SetArgs(args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.args = args
+}
+
+func (r *fakeRunner) SetEnv(env []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.env = env
+}
+
+// Returns the calls made so far.
+func (r *fakeRunner) made() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.calls...)
+}
+
+// Creates a session around a fakeRunner that writes its notices to a buffer.
+func newTestSession() (*session, *fakeRunner, *bytes.Buffer) {
+	runner := &fakeRunner{}
+	out := &bytes.Buffer{}
+	return &session{runner: runner, dw: &watch.DirWatcher{}, quit: func() {}, out: out}, runner, out
+}
+
+// Creates a Changeset in which the given paths were written.
+func changed(paths ...string) watch.Changeset {
+	changes := watch.Changeset{Changes: map[string]watch.EventType{}}
+	for _, path := range paths {
+		changes.Changes[path] = watch.Write
+	}
+	return changes
+}
+
+func Test_session_handle(t *testing.T) {
+
+	t.Run("Restarts the command for changes", func(t *testing.T) {
+		s, runner, _ := newTestSession()
+		if err := s.handle(context.Background(), changed("main.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Errorf("expected calls %v, got %v", expected, runner.made())
+		}
+		events := s.recent(0)
+		if len(events) != 1 || events[0].Kind != "change" || events[0].Held {
+			t.Errorf("recent(); expected a change that wasn't held, got %+v", events)
+		}
+	})
+
+	t.Run("Doesn't restart for a Changeset with only errors", func(t *testing.T) {
+		s, runner, _ := newTestSession()
+		changes := watch.Changeset{Errors: []error{errors.New("watch error")}}
+		if err := s.handle(context.Background(), changes); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		if calls := runner.made(); len(calls) != 0 {
+			t.Errorf("expected no calls, got %v", calls)
+		}
+	})
+
+	t.Run("Returns the error from restarting", func(t *testing.T) {
+		s, runner, _ := newTestSession()
+		runner.err = errors.New("restart error")
+		if err := s.handle(context.Background(), changed("main.go")); err != runner.err {
+			t.Errorf("handle(); expected %v, got %v", runner.err, err)
+		}
+	})
+}
+
+func Test_session_pause(t *testing.T) {
+
+	t.Run("Holds changes while paused and catches up once on resume", func(t *testing.T) {
+		s, runner, out := newTestSession()
+		s.pause()
+		for _, path := range []string{"a.go", "b.go", "a.go"} {
+			if err := s.handle(context.Background(), changed(path)); err != nil {
+				t.Fatalf("unexpected error from handle(): %+v", err)
+			}
+		}
+		if calls := runner.made(); len(calls) != 0 {
+			t.Fatalf("expected no calls while paused, got %v", calls)
+		}
+		if err := s.resume(); err != nil {
+			t.Fatalf("unexpected error from resume(): %+v", err)
+		}
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Errorf("expected calls %v, got %v", expected, runner.made())
+		}
+		if !strings.Contains(out.String(), "2 paths changed while paused") {
+			t.Errorf("expected a notice that 2 paths changed, got %q", out.String())
+		}
+		kinds := []string{}
+		for _, e := range s.recent(0) {
+			kinds = append(kinds, e.Kind)
+		}
+		if expected := []string{"pause", "change", "change", "change", "resume"}; !reflect.DeepEqual(expected, kinds) {
+			t.Errorf("recent(); expected %v, got %v", expected, kinds)
+		}
+	})
+
+	t.Run("Catches up on resume after an overflow", func(t *testing.T) {
+		s, runner, _ := newTestSession()
+		s.pause()
+		if err := s.handle(context.Background(), watch.Changeset{Overflowed: true}); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		if err := s.resume(); err != nil {
+			t.Fatalf("unexpected error from resume(): %+v", err)
+		}
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Errorf("expected calls %v, got %v", expected, runner.made())
+		}
+	})
+
+	t.Run("Doesn't restart on resume when nothing changed", func(t *testing.T) {
+		s, runner, out := newTestSession()
+		s.pause()
+		if err := s.resume(); err != nil {
+			t.Fatalf("unexpected error from resume(): %+v", err)
+		}
+		if calls := runner.made(); len(calls) != 0 {
+			t.Errorf("expected no calls, got %v", calls)
+		}
+		if expected := "pocket: watching paused\npocket: watching resumed\n"; out.String() != expected {
+			t.Errorf("expected notices %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("Pausing twice and resuming twice do nothing more", func(t *testing.T) {
+		s, _, out := newTestSession()
+		s.pause()
+		s.pause()
+		s.resume()
+		s.resume()
+		if expected := "pocket: watching paused\npocket: watching resumed\n"; out.String() != expected {
+			t.Errorf("expected notices %q, got %q", expected, out.String())
+		}
+	})
+}
+
+func Test_session_command(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		keys     string
+		calls    []string
+		paused   bool
+		quit     bool
+		expected string
+	}{
+		{name: "r restarts", keys: "r", calls: []string{"restart"}},
+		{name: "s stops", keys: "s", calls: []string{"stop"}, expected: "pocket: command stopped\n"},
+		{name: "c clears the screen", keys: "c", expected: "\033[H\033[2J"},
+		{name: "p pauses", keys: "p", paused: true, expected: "pocket: watching paused\n"},
+		{name: "p resumes", keys: "pp", expected: "pocket: watching paused\npocket: watching resumed\n"},
+		{name: "q quits", keys: "q", quit: true},
+		{name: "? shows the help", keys: "?", expected: keyHelp},
+		{name: "Other keys do nothing", keys: "x\n "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, runner, out := newTestSession()
+			quit := false
+			s.quit = func() { quit = true }
+			s.readKeys(strings.NewReader(test.keys))
+			if calls := runner.made(); strings.Join(calls, " ") != strings.Join(test.calls, " ") {
+				t.Errorf("expected calls %v, got %v", test.calls, calls)
+			}
+			if s.isPaused() != test.paused {
+				t.Errorf("isPaused(); expected %v, got %v", test.paused, s.isPaused())
+			}
+			if quit != test.quit {
+				t.Errorf("expected quit to be %v, got %v", test.quit, quit)
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected output %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("Reports the errors of the commands", func(t *testing.T) {
+		s, runner, out := newTestSession()
+		runner.err = errors.New("runner error")
+		s.readKeys(strings.NewReader("rs"))
+		if expected := "pocket: runner error\npocket: runner error\n"; out.String() != expected {
+			t.Errorf("expected output %q, got %q", expected, out.String())
+		}
+	})
+}
+
+// A buffer that's safe to write from the session's goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Creates a session that holds changes while the marker of a git operation
+// exists in a temporary git directory, and returns the marker's path.
+func newGitTestSession(t *testing.T) (*session, *fakeRunner, *syncBuffer, string) {
+	s, runner, _ := newTestSession()
+	out := &syncBuffer{}
+	s.out = out
+	gitDir := t.TempDir()
+	s.gitDirs = []string{gitDir}
+	s.gitPollInterval = 5 * time.Millisecond
+	s.gitSettleTime = 20 * time.Millisecond
+	s.gitRemindInterval = time.Hour
+	marker := filepath.Join(gitDir, "index.lock")
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return s, runner, out, marker
+}
+
+// Waits for the condition to hold.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_session_waitForGit(t *testing.T) {
+
+	t.Run("Restarts once for the changes held during a git operation", func(t *testing.T) {
+		s, runner, out, marker := newGitTestSession(t)
+		for _, path := range []string{"a.go", "b.go"} {
+			if err := s.handle(context.Background(), changed(path)); err != nil {
+				t.Fatalf("unexpected error from handle(): %+v", err)
+			}
+		}
+		time.Sleep(5 * s.gitSettleTime)
+		if calls := runner.made(); len(calls) != 0 {
+			t.Fatalf("expected no calls during the operation, got %v", calls)
+		}
+		if err := os.Remove(marker); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool { return len(runner.made()) != 0 })
+		time.Sleep(5 * s.gitSettleTime)
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Errorf("expected calls %v, got %v", expected, runner.made())
+		}
+		if !strings.Contains(out.String(), "git operation finished; 2 paths changed") {
+			t.Errorf("expected a notice that 2 paths changed, got %q", out.String())
+		}
+	})
+
+	t.Run("Holds the changes for resume when paused while waiting", func(t *testing.T) {
+		s, runner, out, marker := newGitTestSession(t)
+		if err := s.handle(context.Background(), changed("a.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		s.pause()
+		if err := os.Remove(marker); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool { return strings.Contains(out.String(), "git operation finished") })
+		if calls := runner.made(); len(calls) != 0 {
+			t.Fatalf("expected no calls while paused, got %v", calls)
+		}
+		if err := s.resume(); err != nil {
+			t.Fatalf("unexpected error from resume(): %+v", err)
+		}
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Errorf("expected calls %v, got %v", expected, runner.made())
+		}
+		if !strings.Contains(out.String(), "1 paths changed while paused") {
+			t.Errorf("expected a notice that 1 path changed, got %q", out.String())
+		}
+	})
+
+	t.Run("Reminds the user of the held changes while the operation lasts", func(t *testing.T) {
+		s, _, out, marker := newGitTestSession(t)
+		s.gitRemindInterval = 20 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := s.handle(ctx, changed("a.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		eventually(t, func() bool {
+			return strings.Contains(out.String(), fmt.Sprintf("git operation still in progress (%s); holding 1 changed paths", marker))
+		})
+	})
+
+	t.Run("A requested restart lets the held changes through", func(t *testing.T) {
+		s, runner, out, marker := newGitTestSession(t)
+		if err := s.handle(context.Background(), changed("a.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		s.command('r')
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Fatalf("expected calls %v, got %v", expected, runner.made())
+		}
+		if !strings.Contains(out.String(), "restarting for 1 paths held for the git operation") {
+			t.Errorf("expected a notice about the held paths, got %q", out.String())
+		}
+		// The changes made after the restart are held until the operation
+		// finishes.
+		if err := s.handle(context.Background(), changed("b.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Fatalf("expected calls %v, got %v", expected, runner.made())
+		}
+		if err := os.Remove(marker); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool { return len(runner.made()) == 2 })
+		if !strings.Contains(out.String(), "git operation finished; 1 paths changed") {
+			t.Errorf("expected a notice that 1 path changed, got %q", out.String())
+		}
+	})
+
+	t.Run("Doesn't restart again when nothing changed after a requested restart", func(t *testing.T) {
+		s, runner, out, marker := newGitTestSession(t)
+		if err := s.handle(context.Background(), changed("a.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		s.command('r')
+		if err := os.Remove(marker); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool { return strings.Contains(out.String(), "git operation finished") })
+		time.Sleep(5 * s.gitSettleTime)
+		if expected := []string{"restart"}; !reflect.DeepEqual(expected, runner.made()) {
+			t.Errorf("expected calls %v, got %v", expected, runner.made())
+		}
+	})
+
+	t.Run("Doesn't restart once the session is done", func(t *testing.T) {
+		s, runner, _, marker := newGitTestSession(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := s.handle(ctx, changed("a.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		cancel()
+		if err := os.Remove(marker); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * s.gitSettleTime)
+		if calls := runner.made(); len(calls) != 0 {
+			t.Errorf("expected no calls, got %v", calls)
+		}
+	})
+}
+
+func Test_session_runEnv(t *testing.T) {
+
+	pid := fmt.Sprintf("POCKET_PARENT_PID=%d", os.Getpid())
+
+	tests := []struct {
+		name     string
+		trigger  string
+		socket   string
+		addr     string
+		expected []string
+	}{
+		{
+			name:     "Describes a run without a trigger or a control API",
+			expected: []string{"POCKET=1", "POCKET_RUN=1", "POCKET_TRIGGER=", pid, "POCKET_CONTROL_SOCKET=", "POCKET_CONTROL_ADDR="},
+		},
+		{
+			name:     "Names the path that triggered the run",
+			trigger:  "main.go",
+			expected: []string{"POCKET=1", "POCKET_RUN=1", "POCKET_TRIGGER=main.go", pid, "POCKET_CONTROL_SOCKET=", "POCKET_CONTROL_ADDR="},
+		},
+		{
+			name:     "Names the control socket",
+			socket:   "/tmp/pocket.sock",
+			expected: []string{"POCKET=1", "POCKET_RUN=1", "POCKET_TRIGGER=", pid, "POCKET_CONTROL_SOCKET=/tmp/pocket.sock", "POCKET_CONTROL_ADDR="},
+		},
+		{
+			name:     "Names the control address",
+			addr:     "127.0.0.1:8080",
+			expected: []string{"POCKET=1", "POCKET_RUN=1", "POCKET_TRIGGER=", pid, "POCKET_CONTROL_SOCKET=", "POCKET_CONTROL_ADDR=127.0.0.1:8080"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, _, _ := newTestSession()
+			s.trigger = test.trigger
+			s.controlSocket = test.socket
+			s.controlAddr = test.addr
+			if actual := s.runEnv(1); !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("runEnv(); expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+
+	t.Run("The trigger applies to one run", func(t *testing.T) {
+		s, _, _ := newTestSession()
+		if err := s.handle(context.Background(), changed("main.go")); err != nil {
+			t.Fatalf("unexpected error from handle(): %+v", err)
+		}
+		if env := s.runEnv(2); env[2] != "POCKET_TRIGGER=main.go" {
+			t.Errorf("runEnv(); expected POCKET_TRIGGER=main.go, got %v", env[2])
+		}
+		if env := s.runEnv(3); env[2] != "POCKET_TRIGGER=" {
+			t.Errorf("runEnv(); expected an empty POCKET_TRIGGER, got %v", env[2])
+		}
+	})
+}
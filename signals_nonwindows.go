@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Pauses the session on SIGUSR1 and resumes it on SIGUSR2 until ctx is done.
+func (s *session) handleSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	s.takeSignals(ctx, signals)
+}
+
+// Pauses or resumes the session for each signal received until ctx is done.
+func (s *session) takeSignals(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGUSR1 {
+				s.pause()
+			} else if err := s.resume(); err != nil {
+				s.notify("%v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func Test_session_takeSignals(t *testing.T) {
+
+	// Sends the signals to the session and waits for it to take them.
+	send := func(s *session, sigs ...os.Signal) {
+		signals := make(chan os.Signal)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.takeSignals(ctx, signals)
+			close(done)
+		}()
+		for _, sig := range sigs {
+			signals <- sig
+		}
+		cancel()
+		<-done
+	}
+
+	t.Run("Pauses on SIGUSR1 and resumes on SIGUSR2", func(t *testing.T) {
+		s, runner, _ := newTestSession()
+		send(s, syscall.SIGUSR1)
+		if !s.isPaused() {
+			t.Fatalf("expected the session to be paused")
+		}
+		s.handle(context.Background(), changed("main.go"))
+		send(s, syscall.SIGUSR2)
+		if s.isPaused() {
+			t.Errorf("expected the session to be resumed")
+		}
+		if calls := runner.made(); strings.Join(calls, " ") != "restart" {
+			t.Errorf("expected calls [restart], got %v", calls)
+		}
+	})
+
+	t.Run("Reports the error from catching up on resume", func(t *testing.T) {
+		s, runner, out := newTestSession()
+		runner.err = errors.New("restart error")
+		send(s, syscall.SIGUSR1)
+		s.handle(context.Background(), changed("main.go"))
+		send(s, syscall.SIGUSR2)
+		if !strings.Contains(out.String(), "pocket: restart error\n") {
+			t.Errorf("expected the error to be reported, got %q", out.String())
+		}
+	})
+}
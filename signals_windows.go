@@ -0,0 +1,9 @@
+package main
+
+import (
+	"context"
+)
+
+// Windows has no user signals so the session can only be paused from the
+// keyboard.
+func (s *session) handleSignals(_ context.Context) {}
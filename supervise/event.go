@@ -0,0 +1,62 @@
+package supervise
+
+import (
+	"time"
+)
+
+// An EventType is the kind of change in the lifecycle of a supervised process.
+type EventType int
+
+// The kinds of lifecycle events.
+const (
+	// Started means the process was started.
+	Started EventType = iota
+
+	// StartFailed means the process could not be started.
+	StartFailed
+
+	// Stopping means the Runner began stopping the process.
+	Stopping
+
+	// Exited means the process exited on its own.
+	Exited
+
+	// Killed means the process exited because the Runner stopped it.
+	Killed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Started:
+		return "started"
+	case StartFailed:
+		return "start failed"
+	case Stopping:
+		return "stopping"
+	case Exited:
+		return "exited"
+	case Killed:
+		return "killed"
+	}
+	return "unknown"
+}
+
+// An Event describes a change in the lifecycle of a supervised process.
+type Event struct {
+
+	// The kind of change.
+	Type EventType
+
+	// The process ID. It's zero when the process failed to start.
+	Pid int
+
+	// The exit code of the process for Exited and Killed events. It's -1 when
+	// the process was terminated by a signal.
+	ExitCode int
+
+	// The error that caused a StartFailed event.
+	Err error
+
+	// The time of the change.
+	Time time.Time
+}
@@ -0,0 +1,349 @@
+// Package supervise starts, stops, and restarts a command, reporting the
+// lifecycle of its process as Events.
+package supervise
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The number of Events buffered for a consumer of Runner.Events.
+const eventBufferSize int = 16
+
+// A Stopper stops processes in a platform-specific way.
+type Stopper interface {
+
+	// Configures the command before it's started so that it can be stopped.
+	Prepare(cmd *exec.Cmd)
+
+	// Stops the process started from the command. The exited channel is
+	// closed when the process has exited.
+	Stop(cmd *exec.Cmd, exited <-chan struct{}) error
+}
+
+// An Option configures a Runner.
+type Option func(*Runner)
+
+// WithStdout sends the standard output of the process to w. It defaults to
+// os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(r *Runner) {
+		r.stdout = w
+	}
+}
+
+// WithStderr sends the standard error of the process to w. It defaults to
+// os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(r *Runner) {
+		r.stderr = w
+	}
+}
+
+// WithStopper makes the Runner stop processes with s rather than the
+// DefaultStopper.
+func WithStopper(s Stopper) Option {
+	return func(r *Runner) {
+		r.stopper = s
+	}
+}
+
+// WithEnvFunc adds the variables returned by f, as KEY=VALUE strings, to the
+// environment of each process after those given to SetEnv. It's called with
+// the number of the run, starting at 1, each time a process is started.
+func WithEnvFunc(f func(run int) []string) Option {
+	return func(r *Runner) {
+		r.envFunc = f
+	}
+}
+
+// ErrRunning is returned by Runner.Start when the process is already running.
+var ErrRunning = errors.New("process is already running")
+
+// A Runner supervises a process started from a command.
+type Runner struct {
+	name    string
+	stdout  io.Writer
+	stderr  io.Writer
+	stopper Stopper
+	envFunc func(run int) []string
+	events  chan Event
+
+	// Serializes Start, Stop and Restart.
+	ops sync.Mutex
+
+	// Guards the fields below. proc is nil until the first start.
+	mu       sync.Mutex
+	args     []string
+	env      []string
+	proc     *process
+	runs     int
+	lastExit *int
+}
+
+// A Status describes the state of a Runner's process.
+type Status struct {
+
+	// Whether the process is running.
+	Running bool
+
+	// The ID of the current or last process. It's zero until a process has
+	// been started.
+	Pid int
+
+	// The time the current or last process was started.
+	StartTime time.Time
+
+	// The number of times a process has been started.
+	Runs int
+
+	// Whether a process has exited, and the exit code of the last one to
+	// exit. It's -1 when the process was terminated by a signal.
+	HasExited    bool
+	LastExitCode int
+}
+
+// The state of a started process.
+type process struct {
+	cmd     *exec.Cmd
+	started time.Time
+
+	// Closed when the process has exited and err has been set.
+	exited chan struct{}
+
+	// The error returned by waiting on the process.
+	err error
+
+	// Whether the Runner is stopping the process.
+	stopping bool
+
+	// Whether the Stopper has stopped the process and what's left of its
+	// children.
+	stopped bool
+}
+
+// New creates a Runner for the command with the given name and arguments.
+// The process isn't started until Start is called.
+func New(name string, args []string, opts ...Option) *Runner {
+	r := &Runner{
+		name:    name,
+		args:    args,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		stopper: DefaultStopper(),
+		events:  make(chan Event, eventBufferSize),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Events returns the channel the Runner reports lifecycle events on. The
+// channel is buffered and events that don't fit are dropped so a Runner never
+// blocks on a consumer that isn't keeping up, or isn't there.
+func (r *Runner) Events() <-chan Event {
+	return r.events
+}
+
+// Start starts the process. It returns ErrRunning if the process is already
+// running.
+func (r *Runner) Start() error {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	return r.start()
+}
+
+// Stop stops the process and waits for it to exit. It does nothing if the
+// process isn't running.
+func (r *Runner) Stop() error {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	return r.stop()
+}
+
+// Restart stops the process if it's running and starts it again.
+func (r *Runner) Restart() error {
+	r.ops.Lock()
+	defer r.ops.Unlock()
+	if err := r.stop(); err != nil {
+		return err
+	}
+	return r.start()
+}
+
+// SetArgs replaces the arguments of the command. They're used from the next
+// time the process is started.
+func (r *Runner) SetArgs(args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.args = append([]string{}, args...)
+}
+
+// SetEnv sets the variables, as KEY=VALUE strings, that are added to the
+// environment the process inherits. They replace inherited variables with the
+// same names and are used from the next time the process is started.
+func (r *Runner) SetEnv(env []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.env = append([]string{}, env...)
+}
+
+// Wait waits for the current process to exit and returns the error from
+// waiting on it, which is nil if it exited successfully. It returns nil
+// immediately if no process was started.
+func (r *Runner) Wait() error {
+	r.mu.Lock()
+	p := r.proc
+	r.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	<-p.exited
+	return p.err
+}
+
+// Status returns the state of the Runner's process.
+func (r *Runner) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := Status{Runs: r.runs}
+	if r.lastExit != nil {
+		status.HasExited = true
+		status.LastExitCode = *r.lastExit
+	}
+	if r.proc != nil {
+		status.Running = !r.proc.hasExited()
+		status.Pid = r.proc.cmd.Process.Pid
+		status.StartTime = r.proc.started
+	}
+	return status
+}
+
+// Implements Start.
+func (r *Runner) start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proc != nil && !r.proc.hasExited() {
+		return ErrRunning
+	}
+	cmd := exec.Command(r.name, r.args...)
+	cmd.Stdout = r.stdout
+	cmd.Stderr = r.stderr
+	env := r.env
+	if r.envFunc != nil {
+		env = append(append([]string{}, env...), r.envFunc(r.runs+1)...)
+	}
+	if len(env) > 0 {
+		// Later values win so ours replace the inherited ones.
+		cmd.Env = append(os.Environ(), env...)
+	}
+	r.stopper.Prepare(cmd)
+	if err := cmd.Start(); err != nil {
+		err = fmt.Errorf("failed to run '%s': %v", r.commandLine(), err)
+		r.emit(Event{Type: StartFailed, Err: err})
+		return err
+	}
+	p := &process{
+		cmd:     cmd,
+		started: time.Now(),
+		exited:  make(chan struct{}),
+	}
+	r.proc = p
+	r.runs++
+	r.emit(Event{Type: Started, Pid: cmd.Process.Pid})
+	go r.wait(p)
+	return nil
+}
+
+// Implements Stop.
+func (r *Runner) stop() error {
+	r.mu.Lock()
+	p := r.proc
+	if p == nil || p.stopped {
+		r.mu.Unlock()
+		return nil
+	}
+	// A process that exited on its own was reported when it exited.
+	exited := p.hasExited()
+	if !exited {
+		p.stopping = true
+	}
+	r.mu.Unlock()
+
+	if !exited {
+		r.emit(Event{Type: Stopping, Pid: p.cmd.Process.Pid})
+	}
+	// The process can leave children running after it exits so the Stopper
+	// runs either way.
+	if err := r.stopper.Stop(p.cmd, p.exited); err != nil {
+		return err
+	}
+	<-p.exited
+	r.mu.Lock()
+	p.stopped = true
+	r.mu.Unlock()
+	return nil
+}
+
+// Waits for the process to exit and reports it.
+func (r *Runner) wait(p *process) {
+	// The error will be 'signal: killed' or 'exit status 1' if we stopped
+	// the process so it's only of interest to callers of Wait.
+	err := p.cmd.Wait()
+	exitCode := p.cmd.ProcessState.ExitCode()
+	r.mu.Lock()
+	p.err = err
+	r.lastExit = &exitCode
+	stopping := p.stopping
+	close(p.exited)
+	r.mu.Unlock()
+
+	event := Event{
+		Type:     Exited,
+		Pid:      p.cmd.Process.Pid,
+		ExitCode: exitCode,
+	}
+	if stopping {
+		event.Type = Killed
+	}
+	r.emit(event)
+}
+
+// Indicates whether the process has exited.
+func (p *process) hasExited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sends an event to the consumer if there's room for it.
+func (r *Runner) emit(event Event) {
+	event.Time = time.Now()
+	select {
+	case r.events <- event:
+	default:
+	}
+}
+
+// Formats the command as it could be typed into a shell.
+func (r *Runner) commandLine() string {
+	tokens := append([]string{r.name}, r.args...)
+	for i, v := range tokens {
+		v = strings.ReplaceAll(v, "\"", "\\\"")
+		if strings.Contains(v, " ") {
+			v = fmt.Sprintf("\"%s\"", v)
+		}
+		tokens[i] = v
+	}
+	return strings.Join(tokens, " ")
+}
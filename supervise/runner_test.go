@@ -0,0 +1,184 @@
+package supervise
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunner(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a POSIX shell")
+	}
+
+	// Collects the types of the events until the given type is seen.
+	eventsUntil := func(t *testing.T, r *Runner, last EventType) []EventType {
+		types := []EventType{}
+		for {
+			select {
+			case event := <-r.Events():
+				types = append(types, event.Type)
+				if event.Type == last {
+					return types
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %v; got %v", last, types)
+			}
+		}
+	}
+
+	t.Run("Reports the exit code of a process that exits on its own", func(t *testing.T) {
+		r := New("sh", []string{"-c", "exit 3"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		if err := r.Wait(); err == nil {
+			t.Errorf("Wait(); expected an error, got nil")
+		}
+		types := eventsUntil(t, r, Exited)
+		if len(types) != 2 || types[0] != Started {
+			t.Errorf("Events(); expected [started exited], got %v", types)
+		}
+		status := r.Status()
+		if status.Running || status.Runs != 1 || !status.HasExited || status.LastExitCode != 3 {
+			t.Errorf("Status(); expected a stopped process that exited with 3, got %+v", status)
+		}
+	})
+
+	t.Run("Reports a stopped process as killed", func(t *testing.T) {
+		r := New("sleep", []string{"10"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		if err := r.Stop(); err != nil {
+			t.Fatalf("unexpected error from Stop(): %+v", err)
+		}
+		expected := []EventType{Started, Stopping, Killed}
+		actual := eventsUntil(t, r, Killed)
+		if len(actual) != len(expected) {
+			t.Fatalf("Events(); expected %v, got %v", expected, actual)
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Errorf("Events(); expected %v, got %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("Refuses to start a running process", func(t *testing.T) {
+		r := New("sleep", []string{"10"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		defer r.Stop()
+		if err := r.Start(); !errors.Is(err, ErrRunning) {
+			t.Errorf("Start(); expected ErrRunning, got %+v", err)
+		}
+	})
+
+	t.Run("Restarts a running process", func(t *testing.T) {
+		r := New("sleep", []string{"10"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		defer r.Stop()
+		if err := r.Restart(); err != nil {
+			t.Fatalf("unexpected error from Restart(): %+v", err)
+		}
+		types := eventsUntil(t, r, Killed)
+		types = append(types, eventsUntil(t, r, Started)...)
+		if len(types) != 4 {
+			t.Errorf("Events(); expected [started stopping killed started], got %v", types)
+		}
+	})
+
+	t.Run("Stops the children of a process that has exited on restart", func(t *testing.T) {
+		// The child appends to the file until it's killed.
+		file := filepath.Join(t.TempDir(), "ticks")
+		r := New("sh", []string{"-c", fmt.Sprintf("(while true; do echo tick >> '%s'; sleep 0.05; done) & exit 0", file)})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		r.Wait()
+		size := func() int64 {
+			fi, err := os.Stat(file)
+			if err != nil {
+				return 0
+			}
+			return fi.Size()
+		}
+		// Make sure the child is running before it's stopped.
+		for deadline := time.Now().Add(5 * time.Second); size() == 0; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the child to start")
+			}
+		}
+		r.SetArgs([]string{"-c", "exit 0"})
+		if err := r.Restart(); err != nil {
+			t.Fatalf("unexpected error from Restart(): %+v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		before := size()
+		time.Sleep(300 * time.Millisecond)
+		if after := size(); after != before {
+			t.Errorf("expected the child to be killed; the file went from %d to %d bytes", before, after)
+		}
+	})
+
+	t.Run("Starts the process with the arguments that were set", func(t *testing.T) {
+		r := New("sh", []string{"-c", "exit 1"})
+		r.SetArgs([]string{"-c", "exit 4"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		r.Wait()
+		if status := r.Status(); status.LastExitCode != 4 {
+			t.Errorf("Status(); expected the process to exit with 4, got %+v", status)
+		}
+	})
+
+	t.Run("Adds the variables that were set to the environment", func(t *testing.T) {
+		t.Setenv("POCKET_TEST_INHERITED", "inherited")
+		t.Setenv("POCKET_TEST_REPLACED", "inherited")
+		var stdout strings.Builder
+		r := New("sh", []string{"-c", "echo $POCKET_TEST_INHERITED $POCKET_TEST_REPLACED $POCKET_TEST_ADDED"}, WithStdout(&stdout))
+		r.SetEnv([]string{"POCKET_TEST_REPLACED=replaced", "POCKET_TEST_ADDED=added"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		r.Wait()
+		if expected := "inherited replaced added\n"; stdout.String() != expected {
+			t.Errorf("expected the process to print %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("Adds the variables for each run to the environment", func(t *testing.T) {
+		var stdout strings.Builder
+		r := New("sh", []string{"-c", "echo $POCKET_TEST_RUN"}, WithStdout(&stdout), WithEnvFunc(func(run int) []string {
+			return []string{fmt.Sprintf("POCKET_TEST_RUN=%d", run)}
+		}))
+		for i := 0; i < 2; i++ {
+			if err := r.Start(); err != nil {
+				t.Fatalf("unexpected error from Start(): %+v", err)
+			}
+			r.Wait()
+		}
+		if expected := "1\n2\n"; stdout.String() != expected {
+			t.Errorf("expected the processes to print %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("Reports a command that can't be started", func(t *testing.T) {
+		r := New("./does-not-exist", nil)
+		if err := r.Start(); err == nil {
+			t.Fatalf("Start(); expected an error, got nil")
+		}
+		eventsUntil(t, r, StartFailed)
+	})
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package supervise
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"syscall"
+	"time"
+)
+
+// DefaultStopper returns the Stopper for the current platform. It interrupts
+// the process group and kills whatever is left of it after a short grace
+// period.
+func DefaultStopper() Stopper {
+	return signalStopper{grace: 200 * time.Millisecond}
+}
+
+// A Stopper that signals the process group.
+type signalStopper struct {
+
+	// How long the processes have to exit after being interrupted.
+	grace time.Duration
+}
+
+// Puts the process in its own group so that its children are stopped too.
+func (s signalStopper) Prepare(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Stops the process group with SIGINT, then SIGKILL once the grace period
+// is over. The group can outlive its leader so the children that are left
+// after the leader has exited get the grace period too.
+func (s signalStopper) Stop(cmd *exec.Cmd, exited <-chan struct{}) error {
+
+	pid := cmd.Process.Pid
+
+	// The group's ID can't be reused while the group has members but it can
+	// be once they've all exited, so we only signal a group that still
+	// exists.
+	if !groupExists(pid) {
+		return nil
+	}
+
+	// If the SIGINT fails then SIGKILL is all we can do anyway.
+	if err := syscall.Kill(-pid, syscall.SIGINT); err == nil {
+		deadline := time.Now().Add(s.grace)
+		for groupExists(pid) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if !groupExists(pid) {
+		return nil
+	}
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to kill %s: %v", path.Base(cmd.Path), err)
+	}
+	return nil
+}
+
+// Indicates whether the process group with the given ID has any members. A
+// leader that has exited but hasn't been waited for is still a member.
+func groupExists(pgid int) bool {
+	return !errors.Is(syscall.Kill(-pgid, 0), syscall.ESRCH)
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+// +build !windows
+
+package supervise
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Not a real test: the Stopper tests run the test binary as a child that
+// handles SIGINT by writing to the file named by SUPERVISE_TEST_HELPER.
+func TestHelperProcess(t *testing.T) {
+	file := os.Getenv("SUPERVISE_TEST_HELPER")
+	if file == "" {
+		return
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, syscall.SIGINT)
+	if err := os.WriteFile(file, []byte("ready\n"), 0644); err != nil {
+		os.Exit(1)
+	}
+	select {
+	case <-interrupted:
+	case <-time.After(10 * time.Second):
+		os.Exit(1)
+	}
+	// Take some of the grace period to clean up.
+	time.Sleep(50 * time.Millisecond)
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		os.Exit(1)
+	}
+	fmt.Fprintln(f, "done")
+	f.Close()
+	os.Exit(0)
+}
+
+func Test_signalStopper(t *testing.T) {
+
+	t.Run("Gives the children of a process that has exited the grace period", func(t *testing.T) {
+		file := t.TempDir() + "/helper"
+		r := New("sh", []string{"-c", fmt.Sprintf("'%s' -test.run=TestHelperProcess & exit 0", os.Args[0])})
+		r.SetEnv([]string{"SUPERVISE_TEST_HELPER=" + file})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		r.Wait()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if content, _ := os.ReadFile(file); strings.HasPrefix(string(content), "ready") {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the child to start")
+			}
+		}
+		if err := r.Stop(); err != nil {
+			t.Fatalf("unexpected error from Stop(): %+v", err)
+		}
+		if content, _ := os.ReadFile(file); string(content) != "ready\ndone\n" {
+			t.Errorf("expected the child to finish handling SIGINT, got %q", content)
+		}
+	})
+
+	t.Run("Doesn't signal a group that has no members left", func(t *testing.T) {
+		r := New("sh", []string{"-c", "exit 0"})
+		if err := r.Start(); err != nil {
+			t.Fatalf("unexpected error from Start(): %+v", err)
+		}
+		r.Wait()
+		pid := r.proc.cmd.Process.Pid
+		if groupExists(pid) {
+			t.Fatalf("expected the group %d to be gone", pid)
+		}
+		if err := r.Stop(); err != nil {
+			t.Errorf("unexpected error from Stop(): %+v", err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package supervise
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+)
+
+// DefaultStopper returns the Stopper for the current platform. It kills the
+// process tree with taskkill.
+func DefaultStopper() Stopper {
+	return taskkillStopper{}
+}
+
+// A Stopper that uses taskkill.
+type taskkillStopper struct{}
+
+// Nothing needs to be prepared for taskkill.
+func (taskkillStopper) Prepare(_ *exec.Cmd) {}
+
+// Stops the process tree with taskkill. The tree can't be found once the
+// process has exited so there's nothing to stop then.
+func (taskkillStopper) Stop(cmd *exec.Cmd, exited <-chan struct{}) error {
+	taskkill := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprint(cmd.Process.Pid))
+	if err := taskkill.Run(); err != nil {
+		select {
+		case <-exited:
+			return nil
+		default:
+		}
+		return fmt.Errorf("error invoking taskkill on %s: %s", path.Base(cmd.Path), err.Error())
+	}
+	return nil
+}
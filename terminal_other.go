@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"errors"
+)
+
+// Keyboard controls aren't supported here so nothing is a terminal.
+func isTerminal(_ int) bool {
+	return false
+}
+
+// Cbreak mode isn't supported here.
+func makeCbreak(_ int) (func(), error) {
+	return nil, errors.New("terminal modes are not supported on this platform")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttd2089/pocket/supervise"
+)
+
+// How long a run must keep running after a failure to count as recovered by
+// default. Commands that run until they're stopped never exit successfully.
+const defaultRecoveryDelay time.Duration = 3 * time.Second
+
+// The ways a termStatus notifies the user that a run failed or recovered.
+const (
+	notifyNone   = "none"
+	notifyOSC9   = "osc9"
+	notifyOSC777 = "osc777"
+	notifyBell   = "bell"
+)
+
+// A termStatus shows the state of the command in the terminal's title and
+// notifies the user through the terminal when a run fails and when the runs
+// recover, using escape sequences rather than a notification daemon.
+type termStatus struct {
+	w io.Writer
+
+	// The name of the command in the title and notifications.
+	label string
+
+	// Whether to set the title, and how to notify.
+	title  bool
+	notify string
+
+	// Whether we're in tmux which sets window names with its own sequence
+	// and passes others through to the outer terminal only when they're
+	// wrapped.
+	tmux bool
+
+	// How long a run must keep running after a failure to count as
+	// recovered.
+	recoveryDelay time.Duration
+
+	// Guards the fields below.
+	mu sync.Mutex
+
+	// Whether the last run failed.
+	failing bool
+
+	// The process of the current run and whether it has exited.
+	pid    int
+	exited bool
+}
+
+// Updates the title and notifies the user for an event of the command's
+// process.
+func (t *termStatus) event(event supervise.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch event.Type {
+	case supervise.Started:
+		t.pid, t.exited = event.Pid, false
+		t.setTitle("running")
+		if t.failing {
+			pid := event.Pid
+			time.AfterFunc(t.recoveryDelay, func() {
+				t.mu.Lock()
+				defer t.mu.Unlock()
+				if t.failing && t.pid == pid && !t.exited {
+					t.recovered()
+				}
+			})
+		}
+	case supervise.Stopping:
+		t.setTitle("restarting")
+	case supervise.StartFailed:
+		t.exited = true
+		t.setTitle("failed to start")
+		t.failed("failed to start")
+	case supervise.Killed:
+		t.exited = true
+		t.setTitle("stopped")
+	case supervise.Exited:
+		t.exited = true
+		if event.ExitCode == 0 {
+			t.setTitle("succeeded")
+			if t.failing {
+				t.recovered()
+			}
+			return
+		}
+		state := fmt.Sprintf("failed with exit code %d", event.ExitCode)
+		t.setTitle(state)
+		t.failed(state)
+	}
+}
+
+// Notifies the user that a run failed unless the last one did too. The caller
+// must hold the lock.
+func (t *termStatus) failed(state string) {
+	if t.failing {
+		return
+	}
+	t.failing = true
+	t.alert(fmt.Sprintf("%s %s", t.label, state))
+}
+
+// Notifies the user that the runs recovered from a failure. The caller must
+// hold the lock.
+func (t *termStatus) recovered() {
+	t.failing = false
+	t.alert(fmt.Sprintf("%s recovered", t.label))
+}
+
+// Sets the title to the label and the given state. The caller must hold the
+// lock.
+func (t *termStatus) setTitle(state string) {
+	if !t.title {
+		return
+	}
+	title := sanitize(fmt.Sprintf("pocket: %s %s", t.label, state))
+	if t.tmux {
+		fmt.Fprintf(t.w, "\033k%s\033\\", title)
+		return
+	}
+	fmt.Fprintf(t.w, "\033]2;%s\007", title)
+}
+
+// Sends a notification with the given message. The caller must hold the lock.
+func (t *termStatus) alert(message string) {
+	message = sanitize(message)
+	switch t.notify {
+	case notifyOSC9:
+		t.passthrough(fmt.Sprintf("\033]9;pocket: %s\007", message))
+	case notifyOSC777:
+		t.passthrough(fmt.Sprintf("\033]777;notify;pocket;%s\007", message))
+	case notifyBell:
+		// tmux raises its own alert for the window on a bell.
+		io.WriteString(t.w, "\007")
+	}
+}
+
+// Writes a sequence meant for the outer terminal, wrapping it for tmux to
+// pass through. tmux 3.3 and later pass them only with allow-passthrough on.
+func (t *termStatus) passthrough(sequence string) {
+	if t.tmux {
+		sequence = "\033Ptmux;" + strings.ReplaceAll(sequence, "\033", "\033\033") + "\033\\"
+	}
+	io.WriteString(t.w, sequence)
+}
+
+// Removes the control characters that would end a sequence early. The
+// semicolons that separate the fields of OSC 777 are replaced too.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		if r == ';' {
+			return ','
+		}
+		return r
+	}, s)
+}
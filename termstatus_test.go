@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttd2089/pocket/supervise"
+)
+
+// Events for a run with the given pid that ends with the given exit code.
+func exitedRun(pid int, exitCode int) []supervise.Event {
+	return []supervise.Event{
+		{Type: supervise.Started, Pid: pid},
+		{Type: supervise.Exited, Pid: pid, ExitCode: exitCode},
+	}
+}
+
+func Test_termStatus_event(t *testing.T) {
+
+	const failed = "\033]9;pocket: cmd failed with exit code 1\007"
+	const recovered = "\033]9;pocket: cmd recovered\007"
+
+	tests := []struct {
+		name     string
+		notify   string
+		title    bool
+		tmux     bool
+		events   [][]supervise.Event
+		expected string
+	}{
+		{
+			name:     "A failure notifies",
+			notify:   notifyOSC9,
+			events:   [][]supervise.Event{exitedRun(1, 1)},
+			expected: failed,
+		},
+		{
+			name:     "Failures after the first don't notify",
+			notify:   notifyOSC9,
+			events:   [][]supervise.Event{exitedRun(1, 1), exitedRun(2, 1), exitedRun(3, 2)},
+			expected: failed,
+		},
+		{
+			name:     "A success after a failure notifies the recovery",
+			notify:   notifyOSC9,
+			events:   [][]supervise.Event{exitedRun(1, 1), exitedRun(2, 0)},
+			expected: failed + recovered,
+		},
+		{
+			name:     "A failure after a recovery notifies",
+			notify:   notifyOSC9,
+			events:   [][]supervise.Event{exitedRun(1, 1), exitedRun(2, 0), exitedRun(3, 1)},
+			expected: failed + recovered + failed,
+		},
+		{
+			name:   "Successes don't notify",
+			notify: notifyOSC9,
+			events: [][]supervise.Event{exitedRun(1, 0), exitedRun(2, 0)},
+		},
+		{
+			name:   "Stopping the command doesn't notify",
+			notify: notifyOSC9,
+			events: [][]supervise.Event{{
+				{Type: supervise.Started, Pid: 1},
+				{Type: supervise.Stopping, Pid: 1},
+				{Type: supervise.Killed, Pid: 1},
+			}},
+		},
+		{
+			name:     "Failing to start notifies",
+			notify:   notifyOSC9,
+			events:   [][]supervise.Event{{{Type: supervise.StartFailed}}},
+			expected: "\033]9;pocket: cmd failed to start\007",
+		},
+		{
+			name:     "OSC 777 notifications have a title and a body",
+			notify:   notifyOSC777,
+			events:   [][]supervise.Event{exitedRun(1, 1)},
+			expected: "\033]777;notify;pocket;cmd failed with exit code 1\007",
+		},
+		{
+			name:     "A bell is rung for a failure",
+			notify:   notifyBell,
+			events:   [][]supervise.Event{exitedRun(1, 1)},
+			expected: "\007",
+		},
+		{
+			name:     "Notifications are passed through tmux",
+			notify:   notifyOSC9,
+			tmux:     true,
+			events:   [][]supervise.Event{exitedRun(1, 1)},
+			expected: "\033Ptmux;\033\033]9;pocket: cmd failed with exit code 1\007\033\\",
+		},
+		{
+			name:   "The title follows the command's state",
+			notify: notifyNone,
+			title:  true,
+			events: [][]supervise.Event{exitedRun(1, 0), {
+				{Type: supervise.Started, Pid: 2},
+				{Type: supervise.Stopping, Pid: 2},
+				{Type: supervise.Killed, Pid: 2},
+			}},
+			expected: "\033]2;pocket: cmd running\007" +
+				"\033]2;pocket: cmd succeeded\007" +
+				"\033]2;pocket: cmd running\007" +
+				"\033]2;pocket: cmd restarting\007" +
+				"\033]2;pocket: cmd stopped\007",
+		},
+		{
+			name:     "The title is set as tmux's window name",
+			notify:   notifyNone,
+			title:    true,
+			tmux:     true,
+			events:   [][]supervise.Event{exitedRun(1, 1)},
+			expected: "\033kpocket: cmd running\033\\\033kpocket: cmd failed with exit code 1\033\\",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &syncBuffer{}
+			term := &termStatus{w: out, label: "cmd", title: test.title, notify: test.notify, tmux: test.tmux, recoveryDelay: time.Hour}
+			for _, events := range test.events {
+				for _, event := range events {
+					term.event(event)
+				}
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("A run that keeps running after a failure notifies the recovery", func(t *testing.T) {
+		out := &syncBuffer{}
+		term := &termStatus{w: out, label: "cmd", notify: notifyOSC9, recoveryDelay: 10 * time.Millisecond}
+		for _, event := range exitedRun(1, 1) {
+			term.event(event)
+		}
+		term.event(supervise.Event{Type: supervise.Started, Pid: 2})
+		eventually(t, func() bool { return out.String() == failed+recovered })
+	})
+
+	t.Run("A run that ends before the delay doesn't notify the recovery", func(t *testing.T) {
+		out := &syncBuffer{}
+		term := &termStatus{w: out, label: "cmd", notify: notifyOSC9, recoveryDelay: 10 * time.Millisecond}
+		for _, event := range exitedRun(1, 1) {
+			term.event(event)
+		}
+		for _, event := range exitedRun(2, 1) {
+			term.event(event)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if out.String() != failed {
+			t.Errorf("expected %q, got %q", failed, out.String())
+		}
+	})
+}
+
+func Test_sanitize(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		s        string
+		expected string
+	}{
+		{name: "Leaves plain text alone", s: "go test failed", expected: "go test failed"},
+		{name: "Removes the control characters that end sequences", s: "a\007b\033\\c", expected: "ab\\c"},
+		{name: "Removes newlines and tabs", s: "a\nb\tc", expected: "abc"},
+		{name: "Removes DEL", s: "a\x7fb", expected: "ab"},
+		{name: "Replaces semicolons", s: "a;b", expected: "a,b"},
+		{name: "Leaves other characters alone", s: "ünï ✓", expected: "ünï ✓"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := sanitize(test.s); actual != test.expected {
+				t.Errorf("sanitize(%q); expected %q, got %q", test.s, test.expected, actual)
+			}
+		})
+	}
+
+	t.Run("Labels can't inject sequences", func(t *testing.T) {
+		out := &syncBuffer{}
+		term := &termStatus{w: out, label: "cmd\007\033]2;x", title: true, recoveryDelay: time.Hour}
+		term.event(supervise.Event{Type: supervise.Started, Pid: 1})
+		if expected := "\033]2;pocket: cmd]2,x running\007"; out.String() != expected {
+			t.Errorf("expected %q, got %q", expected, out.String())
+		}
+		if strings.Count(out.String(), "\033") != 1 {
+			t.Errorf("expected a single sequence, got %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Editors that save atomically write the new content to a temporary file and
+// rename it over the original, often after renaming the original to a backup
+// that's removed afterwards. The events for the temporary and backup files are
+// noise, and the original file is reported as renamed, created, and removed
+// when it was only written.
+
+// Vim's swap files: .swp, then .swo, .swn, and so on down to .swa, and .swx
+// which it creates to probe whether it can write to a directory.
+var vimSwapFile = regexp.MustCompile(`\.sw[a-px]$`)
+
+// The temporary and backup files that editors create while saving, described
+// by a pattern for their names and matched by a function of the name.
+var editorTempFiles = []struct {
+	pattern string
+	match   func(name string) bool
+}{
+	{pattern: "*.sw[a-px]", match: vimSwapFile.MatchString},
+	{pattern: "*~", match: func(name string) bool { return strings.HasSuffix(name, "~") }},
+	{pattern: ".#*", match: func(name string) bool { return strings.HasPrefix(name, ".#") }},
+	{pattern: "*___jb_tmp___", match: func(name string) bool { return strings.HasSuffix(name, "___jb_tmp___") }},
+	{pattern: "*___jb_old___", match: func(name string) bool { return strings.HasSuffix(name, "___jb_old___") }},
+	{pattern: "4913 (+123n)", match: isVimProbeFile},
+}
+
+// EditorTempPatterns describes the names of the editors' temporary and backup
+// files that are ignored unless WithRawEvents is given.
+func EditorTempPatterns() []string {
+	patterns := make([]string, 0, len(editorTempFiles))
+	for _, f := range editorTempFiles {
+		patterns = append(patterns, f.pattern)
+	}
+	return patterns
+}
+
+// Indicates whether a path names a temporary or backup file that editors
+// create while saving.
+func isEditorTempFile(path string) bool {
+	name := filepath.Base(path)
+	for _, f := range editorTempFiles {
+		if f.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Indicates whether a file name is one Vim uses to probe whether it can
+// create files with the owner of the original. It tries 4913 and adds 123
+// until it finds a name that isn't taken.
+func isVimProbeFile(name string) bool {
+	n, err := strconv.Atoi(name)
+	return err == nil && n >= 4913 && (n-4913)%123 == 0
+}
+
+// Folds the events of atomic saves into writes. A file that was removed or
+// renamed away and exists again was replaced, which is to say written. A path
+// that was created and doesn't exist any more was transient and didn't change.
+// Directories are left alone; replacing one isn't a save.
+func (c *Changeset) foldAtomicSaves(lstat func(string) (os.FileInfo, error)) {
+	for path, t := range c.Changes {
+		if t&(Create|Remove|Rename) == 0 {
+			continue
+		}
+		fi, err := lstat(path)
+		switch {
+		case err == nil && fi.IsDir():
+		case err == nil && t&(Remove|Rename) != 0:
+			c.Changes[path] = Write
+		case os.IsNotExist(err) && t&Create != 0:
+			delete(c.Changes, path)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_isEditorTempFile(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "src/4913", expected: true},
+		{path: "src/5036", expected: true},
+		{path: "src/4914", expected: false},
+		{path: "src/.main.go.swp", expected: true},
+		{path: "src/.main.go.swo", expected: true},
+		{path: "src/.main.go.swx", expected: true},
+		{path: "src/main.go~", expected: true},
+		{path: "src/main.go___jb_tmp___", expected: true},
+		{path: "src/main.go___jb_old___", expected: true},
+		{path: "src/.#main.go", expected: true},
+		{path: "src/main.go", expected: false},
+		{path: "src/swap.go", expected: false},
+		{path: "src/.gitignore", expected: false},
+	}
+	for _, test := range tests {
+		if actual := isEditorTempFile(test.path); actual != test.expected {
+			t.Errorf("isEditorTempFile(%s); expected %v, got %v", test.path, test.expected, actual)
+		}
+	}
+}
+
+func Test_EditorTempPatterns(t *testing.T) {
+
+	names := []string{
+		"4913", "5036", "4914", "main.go", "swap.go", ".gitignore", "~main.go", "main~.go",
+		".main.go.swp", ".main.go.swo", ".main.go.swa", ".main.go.swx", ".main.go.swq", ".main.go.swpx",
+		"main.go~", ".#main.go", "#main.go#", "main.go___jb_tmp___", "main.go___jb_old___", "main.go___jb_tmp",
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "*.sw[a-px]", expected: []string{".main.go.swp", ".main.go.swo", ".main.go.swa", ".main.go.swx"}},
+		{pattern: "*~", expected: []string{"main.go~"}},
+		{pattern: ".#*", expected: []string{".#main.go"}},
+		{pattern: "*___jb_tmp___", expected: []string{"main.go___jb_tmp___"}},
+		{pattern: "*___jb_old___", expected: []string{"main.go___jb_old___"}},
+		{pattern: "4913 (+123n)", expected: []string{"4913", "5036"}},
+	}
+
+	t.Run("The patterns describe the names that are matched", func(t *testing.T) {
+		if len(tests) != len(editorTempFiles) {
+			t.Fatalf("expected a test for each of the %d patterns, got %d", len(editorTempFiles), len(tests))
+		}
+		for i, test := range tests {
+			f := editorTempFiles[i]
+			if f.pattern != test.pattern {
+				t.Errorf("expected pattern %d to be %s, got %s", i, test.pattern, f.pattern)
+				continue
+			}
+			matched := []string{}
+			for _, name := range names {
+				if f.match(name) {
+					matched = append(matched, name)
+				}
+			}
+			if !reflect.DeepEqual(test.expected, matched) {
+				t.Errorf("%s; expected to match %v, got %v", test.pattern, test.expected, matched)
+			}
+		}
+	})
+
+	t.Run("Returns a new slice each time", func(t *testing.T) {
+		EditorTempPatterns()[0] = "changed"
+		if EditorTempPatterns()[0] == "changed" {
+			t.Errorf("expected changes to the returned slice not to be kept")
+		}
+	})
+}
+
+func Test_foldAtomicSaves(t *testing.T) {
+
+	dir := t.TempDir()
+	for _, name := range []string{"saved.go", "created.go", "written.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "replaced"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	changes := Changeset{
+		Changes: map[string]EventType{
+			path("saved.go"):     Rename | Create | Write,
+			path("created.go"):   Create | Write,
+			path("written.go"):   Write,
+			path("replaced"):     Remove | Create,
+			path("transient.go"): Create | Write | Remove,
+			path("removed.go"):   Remove,
+			path("moved.go"):     Rename,
+		},
+	}
+	expected := map[string]EventType{
+		path("saved.go"):   Write,
+		path("created.go"): Create | Write,
+		path("written.go"): Write,
+		path("replaced"):   Remove | Create,
+		path("removed.go"): Remove,
+		path("moved.go"):   Rename,
+	}
+	changes.foldAtomicSaves(os.Lstat)
+	if !reflect.DeepEqual(expected, changes.Changes) {
+		t.Errorf("foldAtomicSaves(); expected %+v, got %+v", expected, changes.Changes)
+	}
+}
@@ -0,0 +1,66 @@
+package watch
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A Changeset is the deduplicated set of changes observed during a single
+// debounce window.
+type Changeset struct {
+
+	// The paths that changed mapped to the union of the event types observed
+	// on each of them during the window.
+	Changes map[string]EventType
+
+	// The errors raised by the Watcher during the window.
+	Errors []error
+
+	// Indicates that the Watcher dropped events during the window so Changes
+	// may be incomplete. Handlers should assume anything could have changed.
+	Overflowed bool
+
+	// The time of the first event in the window.
+	Start time.Time
+
+	// The time of the last event in the window.
+	End time.Time
+}
+
+// Adds a WatcherEvent to the Changeset.
+func (c *Changeset) add(event WatcherEvent) {
+	if event.Error != nil {
+		c.Errors = append(c.Errors, event.Error)
+		if errors.Is(event.Error, ErrOverflow) {
+			c.Overflowed = true
+		}
+		return
+	}
+	e := event.Event
+	if c.Changes == nil {
+		c.Changes = map[string]EventType{}
+	}
+	// The same path can be reported as ./pkg and pkg.
+	c.Changes[filepath.Clean(e.Path)] |= e.Type
+	if e.Time.IsZero() {
+		return
+	}
+	if c.Start.IsZero() || e.Time.Before(c.Start) {
+		c.Start = e.Time
+	}
+	if e.Time.After(c.End) {
+		c.End = e.Time
+	}
+}
+
+// Paths returns the changed paths in lexical order.
+func (c Changeset) Paths() []string {
+	paths := make([]string, 0, len(c.Changes))
+	for path := range c.Changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
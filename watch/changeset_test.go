@@ -0,0 +1,30 @@
+package watch
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Changeset_add(t *testing.T) {
+
+	t.Run("Deduplicates the spellings of a path", func(t *testing.T) {
+		c := Changeset{}
+		for _, event := range []FsEvent{
+			{Path: "./pkg", Type: Create},
+			{Path: "pkg", Type: Write},
+			{Path: "./.env", Type: Write},
+			{Path: filepath.FromSlash("pkg/sub/../main.go"), Type: Write},
+		} {
+			c.add(WatcherEvent{Event: event})
+		}
+		expected := map[string]EventType{
+			"pkg":                             Create | Write,
+			".env":                            Write,
+			filepath.FromSlash("pkg/main.go"): Write,
+		}
+		if !reflect.DeepEqual(expected, c.Changes) {
+			t.Errorf("add(); expected %+v, got %+v", expected, c.Changes)
+		}
+	})
+}
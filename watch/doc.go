@@ -0,0 +1,9 @@
+// Package watch recursively watches directory trees and individual files for
+// changes, debounces the changes into Changesets, and optionally filters out
+// the paths ignored by git.
+//
+//	err := watch.Watch(ctx, []string{"."}, func(c watch.Changeset) error {
+//		fmt.Println(c.Paths())
+//		return nil
+//	}, watch.WithGitIgnore())
+package watch
@@ -0,0 +1,212 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The checks an Explanation steps through, in the order the DirWatcher makes
+// them.
+const (
+	CheckScope      = "scope"
+	CheckSymlinks   = "symlinks"
+	CheckFilter     = "filter"
+	CheckGitIgnore  = "gitignore"
+	CheckEditorTemp = "editor_temp"
+	CheckEventTypes = "event_types"
+)
+
+// An ExplainStep is one of the decisions the DirWatcher makes about the
+// events for a path.
+type ExplainStep struct {
+
+	// The check the step makes, one of the Check constants.
+	Check string
+
+	// Whether the events got past the check.
+	Passed bool
+
+	// What the check found.
+	Detail string
+}
+
+// An Explanation describes whether the DirWatcher would report a change to a
+// path and how it decides.
+type Explanation struct {
+
+	// The path that was explained.
+	Path string
+
+	// Whether a change to the path would be reported in a Changeset.
+	Reported bool
+
+	// The decisions up to and including the first one that failed.
+	Steps []ExplainStep
+}
+
+// Adds a step and indicates whether it passed.
+func (e *Explanation) step(check string, passed bool, format string, v ...interface{}) bool {
+	e.Steps = append(e.Steps, ExplainStep{Check: check, Passed: passed, Detail: fmt.Sprintf(format, v...)})
+	return passed
+}
+
+// Explain describes whether a change to the given path would be reported and
+// each of the decisions that lead there. The path doesn't need to exist. The
+// decisions are made on the configuration rather than on the watches so
+// Explain doesn't need Watch to be running.
+func (dw *DirWatcher) Explain(path string) (Explanation, error) {
+	e := Explanation{Path: path}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return e, err
+	}
+
+	for _, file := range dw.filePaths {
+		if fileAbs, err := filepath.Abs(file); err == nil && fileAbs == abs {
+			e.step(CheckScope, true, "watched as an individual file")
+			// Files asked for by name skip the gitignore and editor checks.
+			if ok, err := dw.explainFilter(&e, file); !ok || err != nil {
+				return e, err
+			}
+			e.Reported = dw.explainEventTypes(&e)
+			return e, nil
+		}
+	}
+
+	absRoots := make([]string, 0, len(dw.roots))
+	rootsByAbs := map[string]string{}
+	for _, root := range dw.roots {
+		rootAbs, err := filepath.Abs(root)
+		if err != nil {
+			return e, err
+		}
+		absRoots = append(absRoots, rootAbs)
+		rootsByAbs[rootAbs] = root
+	}
+	rootAbs, ok := rootFor(absRoots, abs)
+	if !ok {
+		e.step(CheckScope, false, "outside of the watched directories %s", strings.Join(dw.roots, ", "))
+		return e, nil
+	}
+	root := rootsByAbs[rootAbs]
+	rel, err := filepath.Rel(rootAbs, abs)
+	if err != nil {
+		return e, err
+	}
+	if rel == "." {
+		e.step(CheckScope, false, "the watched directory %s itself; changes are reported for the entries in it", root)
+		return e, nil
+	}
+	e.step(CheckScope, true, "inside the watched directory %s", root)
+
+	// Report the path the way the Watcher would.
+	watched := filepath.Join(root, rel)
+	if !dw.explainSymlinks(&e, root, rel) {
+		return e, nil
+	}
+	if ok, err := dw.explainFilter(&e, watched); !ok || err != nil {
+		return e, err
+	}
+	if ok, err := dw.explainGitIgnore(&e, root, watched); !ok || err != nil {
+		return e, err
+	}
+	if dw.normalize && isEditorTempFile(watched) && !dw.isDir(watched) {
+		e.step(CheckEditorTemp, false, "an editor's temporary file")
+		return e, nil
+	}
+	if dw.normalize {
+		e.step(CheckEditorTemp, true, "not an editor's temporary file")
+	}
+	e.Reported = dw.explainEventTypes(&e)
+	return e, nil
+}
+
+// Checks the directories between root and the path for symlinks that the
+// walk wouldn't follow.
+func (dw *DirWatcher) explainSymlinks(e *Explanation, root string, rel string) bool {
+	walker := dirWalker{symlinks: dw.symlinks, roots: dw.roots}
+	var realRoots []string
+	dir := root
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	for _, part := range parts {
+		if part == "." {
+			break
+		}
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		switch dw.symlinks {
+		case SymlinkIgnore:
+			return e.step(CheckSymlinks, false, "%s is a symlinked directory and symlinks aren't followed", dir)
+		case SymlinkConfine:
+			target, err := realPath(dir)
+			if err != nil {
+				return e.step(CheckSymlinks, false, "%s is a symlink that can't be followed: %v", dir, err)
+			}
+			if realRoots == nil {
+				realRoots = walker.realRoots()
+			}
+			if _, ok := rootFor(realRoots, target); !ok {
+				return e.step(CheckSymlinks, false, "%s links to %s outside of the watched directories", dir, target)
+			}
+		}
+	}
+	return e.step(CheckSymlinks, true, "no symlinks in the way")
+}
+
+// Checks the path against the filter given by WithFilter.
+func (dw *DirWatcher) explainFilter(e *Explanation, path string) (bool, error) {
+	if dw.filter == nil {
+		return true, nil
+	}
+	filtered, err := dw.filter(FsEvent{Path: path, Type: Write})
+	if err != nil {
+		return false, err
+	}
+	if filtered {
+		return e.step(CheckFilter, false, "excluded by the filter"), nil
+	}
+	return e.step(CheckFilter, true, "not excluded by the filter"), nil
+}
+
+// Checks the path against the ignore rules of the root's repository.
+func (dw *DirWatcher) explainGitIgnore(e *Explanation, root string, path string) (bool, error) {
+	if !dw.gitIgnore {
+		return true, nil
+	}
+	if !inGitWorkTree(root) {
+		return e.step(CheckGitIgnore, true, "not in a git repository"), nil
+	}
+	// Events aren't skipped when the filter fails so neither is the path.
+	ignored, err := GitIgnored(root, path)
+	if err != nil {
+		return e.step(CheckGitIgnore, true, "not ignored since git failed: %v", err), nil
+	}
+	rule, err := GitIgnoreRule(root, path)
+	if err != nil {
+		return e.step(CheckGitIgnore, true, "not ignored since git failed: %v", err), nil
+	}
+	switch {
+	case ignored && rule != nil:
+		return e.step(CheckGitIgnore, false, "ignored by %s:%d: %s", rule.Source, rule.Line, rule.Pattern), nil
+	case ignored:
+		return e.step(CheckGitIgnore, false, "treated as part of the .git directory"), nil
+	case rule != nil && !rule.Ignores():
+		return e.step(CheckGitIgnore, true, "re-included by %s:%d: %s", rule.Source, rule.Line, rule.Pattern), nil
+	}
+	return e.step(CheckGitIgnore, true, "not ignored by git"), nil
+}
+
+// Describes which event types are reported. It always passes since some types
+// are always reported.
+func (dw *DirWatcher) explainEventTypes(e *Explanation) bool {
+	reported := allEventTypes &^ dw.ignored
+	if dw.ignored == 0 {
+		return e.step(CheckEventTypes, true, "all event types are reported: %v", reported)
+	}
+	return e.step(CheckEventTypes, true, "%v events are reported; %v events are not", reported, dw.ignored)
+}
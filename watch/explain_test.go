@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_DirWatcher_Explain(t *testing.T) {
+
+	// Collects the checks of an Explanation and whether each passed.
+	checks := func(e Explanation) []string {
+		actual := []string{}
+		for _, step := range e.Steps {
+			if step.Passed {
+				actual = append(actual, step.Check)
+			} else {
+				actual = append(actual, "!"+step.Check)
+			}
+		}
+		return actual
+	}
+
+	root := t.TempDir()
+	other := t.TempDir()
+	file := filepath.Join(other, "file.txt")
+	if err := os.Mkdir(filepath.Join(root, "4913"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dw := DirWatcher{
+		isDir:     isDir,
+		normalize: true,
+		ignored:   Attrib,
+		filter: func(event FsEvent) (bool, error) {
+			return strings.HasSuffix(event.Path, ".log"), nil
+		},
+		roots:     []string{root},
+		filePaths: []string{file},
+	}
+
+	cases := []struct {
+		name     string
+		path     string
+		reported bool
+		expected []string
+	}{
+		{"Reports a path in a root", filepath.Join(root, "src", "main.go"), true,
+			[]string{CheckScope, CheckSymlinks, CheckFilter, CheckEditorTemp, CheckEventTypes}},
+		{"Stops at a path outside of the roots", filepath.Join(other, "other.txt"), false,
+			[]string{"!" + CheckScope}},
+		{"Stops at a filtered path", filepath.Join(root, "app.log"), false,
+			[]string{CheckScope, CheckSymlinks, "!" + CheckFilter}},
+		{"Stops at an editor's temporary file", filepath.Join(root, ".main.go.swp"), false,
+			[]string{CheckScope, CheckSymlinks, CheckFilter, "!" + CheckEditorTemp}},
+		{"Reports a directory named like an editor's temporary file", filepath.Join(root, "4913"), true,
+			[]string{CheckScope, CheckSymlinks, CheckFilter, CheckEditorTemp, CheckEventTypes}},
+		{"Reports an individual file", file, true,
+			[]string{CheckScope, CheckFilter, CheckEventTypes}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e, err := dw.Explain(c.path)
+			if err != nil {
+				t.Fatalf("unexpected error from Explain(): %+v", err)
+			}
+			actual := checks(e)
+			if e.Reported != c.reported || strings.Join(actual, " ") != strings.Join(c.expected, " ") {
+				t.Errorf("Explain(%s); expected %v %v, got %v %v", c.path, c.reported, c.expected, e.Reported, actual)
+			}
+		})
+	}
+
+	t.Run("Stops at a symlinked directory that isn't followed", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("creating symlinks needs privileges on Windows")
+		}
+		if err := os.Symlink(other, filepath.Join(root, "link")); err != nil {
+			t.Fatal(err)
+		}
+		e, err := dw.Explain(filepath.Join(root, "link", "file.txt"))
+		if err != nil {
+			t.Fatalf("unexpected error from Explain(): %+v", err)
+		}
+		expected := []string{CheckScope, "!" + CheckSymlinks}
+		if actual := checks(e); e.Reported || strings.Join(actual, " ") != strings.Join(expected, " ") {
+			t.Errorf("Explain(); expected false %v, got %v %v", expected, e.Reported, actual)
+		}
+	})
+
+	t.Run("Doesn't ignore a path in a root outside of a repository", func(t *testing.T) {
+		if !GitIgnoreSupported() {
+			t.Skip("git is not installed")
+		}
+		root := t.TempDir()
+		if inGitWorkTree(root) {
+			t.Skip("the temporary directory is in a git repository")
+		}
+		dw := DirWatcher{gitIgnore: true, roots: []string{root}}
+		e, err := dw.Explain(filepath.Join(root, "d1", "new.txt"))
+		if err != nil {
+			t.Fatalf("unexpected error from Explain(): %+v", err)
+		}
+		expected := []string{CheckScope, CheckSymlinks, CheckGitIgnore, CheckEventTypes}
+		if actual := checks(e); !e.Reported || strings.Join(actual, " ") != strings.Join(expected, " ") {
+			t.Errorf("Explain(); expected true %v, got %v %v", expected, e.Reported, actual)
+		}
+	})
+}
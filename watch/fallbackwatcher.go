@@ -0,0 +1,105 @@
+package watch
+
+import (
+	"sync"
+)
+
+// NewFallbackWatcher creates a Watcher that watches paths with primary until
+// it runs out of watches and then watches the remaining paths with fallback.
+// It applies the WithLogger option.
+func NewFallbackWatcher(primary, fallback Watcher, opts ...Option) Watcher {
+	w := &fallbackWatcher{
+		primary:  primary,
+		fallback: fallback,
+		logger:   newConfig(opts).logger,
+		fellBack: map[string]bool{},
+		events:   make(chan WatcherEvent, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	for _, source := range []Watcher{primary, fallback} {
+		wg.Add(1)
+		go func(events <-chan WatcherEvent) {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case w.events <- event:
+				case <-w.done:
+					return
+				}
+			}
+		}(source.Events())
+	}
+	go func() {
+		wg.Wait()
+		close(w.events)
+		close(w.stopped)
+	}()
+	return w
+}
+
+// An implementation of Watcher that falls back to a second Watcher when the
+// first runs out of watches.
+type fallbackWatcher struct {
+	primary  Watcher
+	fallback Watcher
+	logger   Logger
+	events   chan WatcherEvent
+
+	// The paths that are watched by the fallback Watcher.
+	fellBack map[string]bool
+	mu       sync.Mutex
+
+	// Closed by Stop to tell the forwarding goroutines to return, and when
+	// they have.
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// Tells the watcher to begin watching the given file or directory (not recursive).
+func (w *fallbackWatcher) Watch(path string) error {
+	err := w.primary.Watch(path)
+	if err == nil || !IsWatchLimit(err) {
+		return err
+	}
+	if err := w.fallback.Watch(path); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.fellBack) == 0 {
+		logRecord(w.logger, newRecord(RecordWatch, Fields{"path": path, "action": "fall_back", "error": err.Error()},
+			"watch limit reached, falling back for %s and beyond: %v", path, err).at(LevelWarn))
+	}
+	w.fellBack[path] = true
+	return nil
+}
+
+// Stops watching the given file or directory.
+func (w *fallbackWatcher) Unwatch(path string) error {
+	w.mu.Lock()
+	fellBack := w.fellBack[path]
+	delete(w.fellBack, path)
+	w.mu.Unlock()
+	if fellBack {
+		return w.fallback.Unwatch(path)
+	}
+	return w.primary.Unwatch(path)
+}
+
+// The channel that the watcher communicates events and errors on.
+func (w *fallbackWatcher) Events() <-chan WatcherEvent {
+	return w.events
+}
+
+// Stops the Watcher.
+func (w *fallbackWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		w.primary.Stop()
+		w.fallback.Stop()
+	})
+	<-w.stopped
+}
@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// A Watcher that records the paths it's asked to watch and unwatch.
+type recordingWatcher struct {
+	testWatcher
+	mu        sync.Mutex
+	watched   []string
+	unwatched []string
+}
+
+func newRecordingWatcher(watch func(string) error) *recordingWatcher {
+	w := &recordingWatcher{}
+	w.testWatcher = testWatcher{
+		watch: func(path string) error {
+			if err := watch(path); err != nil {
+				return err
+			}
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.watched = append(w.watched, path)
+			return nil
+		},
+		unwatch: func(path string) error {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.unwatched = append(w.unwatched, path)
+			return nil
+		},
+		events: make(chan WatcherEvent),
+	}
+	return w
+}
+
+func Test_fallbackWatcher(t *testing.T) {
+
+	// A primary Watcher that runs out of watches after two paths.
+	newWatchers := func() (*recordingWatcher, *recordingWatcher, Watcher) {
+		count := 0
+		primary := newRecordingWatcher(func(string) error {
+			if count++; count > 2 {
+				return fmt.Errorf("failed to add watcher: %w", syscall.ENOSPC)
+			}
+			return nil
+		})
+		fallback := newRecordingWatcher(func(string) error { return nil })
+		return primary, fallback, NewFallbackWatcher(primary, fallback)
+	}
+
+	t.Run("Watches with the fallback once the primary runs out of watches", func(t *testing.T) {
+		primary, fallback, w := newWatchers()
+		defer w.Stop()
+		for _, path := range []string{"a", "b", "c", "d"} {
+			if err := w.Watch(path); err != nil {
+				t.Fatalf("unexpected error from Watch(%s): %+v", path, err)
+			}
+		}
+		if expected := []string{"a", "b"}; !reflect.DeepEqual(expected, primary.watched) {
+			t.Errorf("expected the primary to watch %v, got %v", expected, primary.watched)
+		}
+		if expected := []string{"c", "d"}; !reflect.DeepEqual(expected, fallback.watched) {
+			t.Errorf("expected the fallback to watch %v, got %v", expected, fallback.watched)
+		}
+	})
+
+	t.Run("Returns the primary's other errors", func(t *testing.T) {
+		expected := errors.New("watch error")
+		primary := newRecordingWatcher(func(string) error { return expected })
+		fallback := newRecordingWatcher(func(string) error { return nil })
+		w := NewFallbackWatcher(primary, fallback)
+		defer w.Stop()
+		if err := w.Watch("a"); err != expected {
+			t.Errorf("Watch(); expected %v, got %v", expected, err)
+		}
+		if len(fallback.watched) != 0 {
+			t.Errorf("expected the fallback not to watch anything, got %v", fallback.watched)
+		}
+	})
+
+	t.Run("Unwatches with the Watcher that watches the path", func(t *testing.T) {
+		primary, fallback, w := newWatchers()
+		defer w.Stop()
+		for _, path := range []string{"a", "b", "c"} {
+			if err := w.Watch(path); err != nil {
+				t.Fatalf("unexpected error from Watch(%s): %+v", path, err)
+			}
+		}
+		for _, path := range []string{"c", "a"} {
+			if err := w.Unwatch(path); err != nil {
+				t.Fatalf("unexpected error from Unwatch(%s): %+v", path, err)
+			}
+		}
+		if expected := []string{"a"}; !reflect.DeepEqual(expected, primary.unwatched) {
+			t.Errorf("expected the primary to unwatch %v, got %v", expected, primary.unwatched)
+		}
+		if expected := []string{"c"}; !reflect.DeepEqual(expected, fallback.unwatched) {
+			t.Errorf("expected the fallback to unwatch %v, got %v", expected, fallback.unwatched)
+		}
+	})
+
+	t.Run("Forwards the events of both Watchers", func(t *testing.T) {
+		primary, fallback, w := newWatchers()
+		go func() {
+			primary.events <- WatcherEvent{Event: FsEvent{Path: "a", Type: Write}}
+			fallback.events <- WatcherEvent{Event: FsEvent{Path: "c", Type: Write}}
+		}()
+		paths := map[string]bool{}
+		for len(paths) < 2 {
+			paths[(<-w.Events()).Event.Path] = true
+		}
+		if !paths["a"] || !paths["c"] {
+			t.Errorf("expected events for a and c, got %v", paths)
+		}
+		w.Stop()
+		if _, ok := <-w.Events(); ok {
+			t.Errorf("expected the events to be closed after Stop()")
+		}
+	})
+}
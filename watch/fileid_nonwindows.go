@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package watch
+
+import (
+	"os"
+	"syscall"
+)
+
+// Gets the device and inode numbers that identify the file described by the
+// given FileInfo.
+func fileID(fi os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
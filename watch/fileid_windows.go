@@ -0,0 +1,11 @@
+package watch
+
+import (
+	"os"
+)
+
+// Gets the device and inode numbers that identify the file described by the
+// given FileInfo. They aren't available from a FileInfo on Windows.
+func fileID(_ os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	return 0, 0, false
+}
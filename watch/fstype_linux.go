@@ -0,0 +1,28 @@
+package watch
+
+import (
+	"syscall"
+)
+
+// The magic numbers of file systems on which inotify doesn't reliably report
+// changes, mapped to their names.
+var noInotifyFileSystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x786f4256: "vboxsf",
+}
+
+// NeedsPolling indicates whether the given path is on a file system that
+// needs to be polled for changes, and if so the name of the file system.
+func NeedsPolling(path string) (bool, string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false, "", err
+	}
+	name, ok := noInotifyFileSystems[uint32(st.Type)]
+	return ok, name, nil
+}
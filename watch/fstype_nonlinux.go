@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+// NeedsPolling indicates whether the given path is on a file system that
+// needs to be polled for changes, and if so the name of the file system. We
+// only know how to tell on Linux.
+func NeedsPolling(_ string) (bool, string, error) {
+	return false, "", nil
+}
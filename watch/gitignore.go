@@ -0,0 +1,267 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GitIgnoreSupported indicates whether the GitIgnored function is available.
+func GitIgnoreSupported() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// Creates a Filter that filters out the events for paths that are ignored by
+// the git repository of the root they're in. The given files are never
+// filtered out, and neither are the paths in roots outside of a repository.
+func gitIgnoreFilter(roots []string, files []string) Filter {
+	explicit := map[string]bool{}
+	for _, file := range files {
+		explicit[filepath.Clean(file)] = true
+	}
+	// Asking git about a path outside of a repository fails so we find out
+	// once which roots are in one rather than failing for every event.
+	inRepo := map[string]bool{}
+	for _, root := range roots {
+		inRepo[root] = inGitWorkTree(root)
+	}
+	return func(event FsEvent) (bool, error) {
+		// Files that were asked for by name are never ignored.
+		if explicit[filepath.Clean(event.Path)] {
+			return false, nil
+		}
+		// Each root is subject to the ignore rules of its own repository.
+		root, ok := rootFor(roots, event.Path)
+		if !ok || !inRepo[root] {
+			return false, nil
+		}
+		return GitIgnored(root, event.Path)
+	}
+}
+
+// Indicates whether dir is in the work tree of a git repository.
+func inGitWorkTree(dir string) bool {
+	inside, ok := gitOutput(dir, "rev-parse", "--is-inside-work-tree")
+	return ok && inside == "true"
+}
+
+// GitIgnored checks if the given path is gitignored by the repository that
+// contains the directory dir.
+func GitIgnored(dir string, path string) (bool, error) {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		path = rel
+	}
+	cmd := exec.Command("git", "check-ignore", "-q", path)
+	cmd.Dir = dir
+	var stdoutBuf bytes.Buffer
+	var stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	// Run() returns the "exit status 1" error when the file isn't ignored so
+	// that's not an error for us.
+	if err := cmd.Run(); err != nil && err.Error() != "exit status 1" {
+		if stderr := strings.TrimSpace(stderrBuf.String()); stderr != "" {
+			return false, errors.New(stderr)
+		}
+		return false, err
+	}
+	if stderr := stderrBuf.String(); stderr != "" {
+		return false, errors.New(stderr)
+	}
+	if stdout := stdoutBuf.String(); stdout != "" {
+		return false, errors.New(stdout)
+	}
+
+	exitCode := cmd.ProcessState.ExitCode()
+	if exitCode == 0 {
+		return true, nil
+	}
+	// git does not consider the .git folder and contents to be ignored.
+	if exitCode == 1 && strings.HasPrefix(path, ".git") {
+		return true, nil
+	}
+	return false, nil
+}
+
+// An IgnoreRule is the gitignore pattern that matches a path.
+type IgnoreRule struct {
+
+	// The file the pattern is in, relative to the repository, or the path
+	// of a global excludes file.
+	Source string
+
+	// The line of the pattern in Source.
+	Line int
+
+	// The pattern as it's written. Patterns that start with ! re-include
+	// paths rather than ignoring them.
+	Pattern string
+}
+
+// Ignores indicates whether the rule ignores the paths it matches rather than
+// re-including them.
+func (r IgnoreRule) Ignores() bool {
+	return !strings.HasPrefix(r.Pattern, "!")
+}
+
+func (r IgnoreRule) String() string {
+	return fmt.Sprintf("%s:%d:%s", r.Source, r.Line, r.Pattern)
+}
+
+// Parses the <source>:<line>:<pattern> that git check-ignore -v prints before
+// the path. The source can contain colons so we look for the first :<line>:.
+var checkIgnoreVerbose = regexp.MustCompile(`^(.*?):(\d+):(.*)$`)
+
+// GitIgnoreRule returns the gitignore rule that matches the given path in the
+// repository that contains the directory dir, or nil when no rule matches.
+func GitIgnoreRule(dir string, path string) (*IgnoreRule, error) {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		path = rel
+	}
+	cmd := exec.Command("git", "check-ignore", "-v", path)
+	cmd.Dir = dir
+	var stdoutBuf bytes.Buffer
+	var stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	// Run() returns the "exit status 1" error when no rule matches so that's
+	// not an error for us.
+	if err := cmd.Run(); err != nil && err.Error() != "exit status 1" {
+		if stderr := strings.TrimSpace(stderrBuf.String()); stderr != "" {
+			return nil, errors.New(stderr)
+		}
+		return nil, err
+	}
+	line := strings.TrimRight(stdoutBuf.String(), "\n")
+	if line == "" {
+		return nil, nil
+	}
+	if tab := strings.LastIndex(line, "\t"); tab >= 0 {
+		line = line[:tab]
+	}
+	m := checkIgnoreVerbose.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected output from git check-ignore: %s", line)
+	}
+	n, _ := strconv.Atoi(m[2])
+	return &IgnoreRule{Source: m[1], Line: n, Pattern: m[3]}, nil
+}
+
+// GitIgnorePatterns returns the gitignore patterns that apply to the given
+// roots: those in the user's global excludes file, the info/exclude files of
+// the roots' repositories, the .gitignore files between the repositories' top
+// levels and the roots, and the .gitignore files in the given directories.
+// Roots outside of a repository have no patterns.
+func GitIgnorePatterns(roots []string, dirs []string) ([]IgnoreRule, error) {
+	sources := []string{}
+	seen := map[string]bool{}
+	add := func(source string) {
+		abs, err := filepath.Abs(source)
+		if err != nil || seen[abs] {
+			return
+		}
+		seen[abs] = true
+		sources = append(sources, source)
+	}
+	for _, root := range roots {
+		top, ok := gitOutput(root, "rev-parse", "--show-toplevel")
+		if !ok {
+			continue
+		}
+		if global, ok := gitOutput(root, "config", "--path", "core.excludesFile"); ok && global != "" {
+			add(global)
+		} else if global := defaultExcludesFile(); global != "" {
+			add(global)
+		}
+		if exclude, ok := gitOutput(root, "rev-parse", "--git-path", "info/exclude"); ok {
+			if !filepath.IsAbs(exclude) {
+				exclude = filepath.Join(root, exclude)
+			}
+			add(exclude)
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		// The .gitignore files above the root apply to it too.
+		parents := []string{}
+		for dir := filepath.Dir(abs); pathWithin(dir, top) && dir != abs; dir = filepath.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+			if dir == top {
+				break
+			}
+		}
+		for _, dir := range parents {
+			add(filepath.Join(dir, ".gitignore"))
+		}
+	}
+	for _, dir := range dirs {
+		add(filepath.Join(dir, ".gitignore"))
+	}
+
+	rules := []IgnoreRule{}
+	for _, source := range sources {
+		fileRules, err := readIgnoreFile(source)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+	return rules, nil
+}
+
+// Reads the patterns in a gitignore file, skipping blank lines and comments.
+// A file that doesn't exist has no patterns.
+func readIgnoreFile(path string) ([]IgnoreRule, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules := []IgnoreRule{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		// Trailing spaces are ignored unless they're escaped; the escaped
+		// ones are rare enough to show as written.
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, IgnoreRule{Source: path, Line: n, Pattern: line})
+	}
+	return rules, scanner.Err()
+}
+
+// The global excludes file git uses when core.excludesFile isn't set.
+func defaultExcludesFile() string {
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return filepath.Join(config, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// Runs git in dir and returns its output without the trailing newline, or
+// false when it fails.
+func gitOutput(dir string, args ...string) (string, bool) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimRight(string(out), "\n"), true
+}
@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Creates a git repository in a temporary directory that ignores *.log.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func Test_gitIgnoreFilter(t *testing.T) {
+
+	if !GitIgnoreSupported() {
+		t.Skip("git is not installed")
+	}
+
+	t.Run("Filters the paths git ignores", func(t *testing.T) {
+		root := newTestRepo(t)
+		filter := gitIgnoreFilter([]string{root}, []string{filepath.Join(root, "kept.log")})
+		tests := []struct {
+			path     string
+			expected bool
+		}{
+			{path: filepath.Join(root, "out.log"), expected: true},
+			{path: filepath.Join(root, "main.go"), expected: false},
+			{path: filepath.Join(root, "kept.log"), expected: false},
+		}
+		for _, test := range tests {
+			actual, err := filter(FsEvent{Path: test.path, Type: Write})
+			if err != nil {
+				t.Fatalf("unexpected error from the Filter: %+v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("filter(%s); expected %v, got %v", test.path, test.expected, actual)
+			}
+		}
+	})
+
+	t.Run("Doesn't filter or fail for paths outside of a repository", func(t *testing.T) {
+		root := t.TempDir()
+		if inGitWorkTree(root) {
+			t.Skip("the temporary directory is in a git repository")
+		}
+		filter := gitIgnoreFilter([]string{root}, nil)
+		actual, err := filter(FsEvent{Path: filepath.Join(root, "out.log"), Type: Write})
+		if err != nil || actual {
+			t.Errorf("filter(); expected false and no error, got %v, %v", actual, err)
+		}
+	})
+}
+
+func Test_GitIgnored(t *testing.T) {
+
+	if !GitIgnoreSupported() {
+		t.Skip("git is not installed")
+	}
+
+	t.Run("Reports git's error outside of a repository", func(t *testing.T) {
+		root := t.TempDir()
+		if inGitWorkTree(root) {
+			t.Skip("the temporary directory is in a git repository")
+		}
+		_, err := GitIgnored(root, filepath.Join(root, "out.log"))
+		if err == nil || !strings.Contains(err.Error(), "not a git repository") {
+			t.Errorf("GitIgnored(); expected git's error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// The entries git creates in its directory while an operation that rewrites
+// the work tree is in progress. A merge, cherry-pick or revert that stops on
+// conflicts is in progress until it's committed or aborted.
+var gitOperationMarkers = []string{
+	"index.lock",
+	"rebase-merge",
+	"rebase-apply",
+	"MERGE_HEAD",
+	"CHERRY_PICK_HEAD",
+	"REVERT_HEAD",
+}
+
+// GitDir returns the absolute path of the git directory of the repository
+// that contains dir, or false when dir isn't in a repository or git isn't
+// installed.
+func GitDir(dir string) (string, bool) {
+	return gitOutput(dir, "rev-parse", "--absolute-git-dir")
+}
+
+// GitOperation returns the path of the marker of a git operation that's in
+// progress in the given git directory, or "" when there's none.
+func GitOperation(gitDir string) string {
+	for _, marker := range gitOperationMarkers {
+		path := filepath.Join(gitDir, marker)
+		if _, err := os.Lstat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_GitOperation(t *testing.T) {
+	gitDir := t.TempDir()
+	if actual := GitOperation(gitDir); actual != "" {
+		t.Errorf("GitOperation(); expected no operation, got %s", actual)
+	}
+
+	rebase := filepath.Join(gitDir, "rebase-merge")
+	if err := os.Mkdir(rebase, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if actual := GitOperation(gitDir); actual != rebase {
+		t.Errorf("GitOperation(); expected %s, got %s", rebase, actual)
+	}
+
+	if err := os.Remove(rebase); err != nil {
+		t.Fatal(err)
+	}
+	lock := filepath.Join(gitDir, "index.lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if actual := GitOperation(gitDir); actual != lock {
+		t.Errorf("GitOperation(); expected %s, got %s", lock, actual)
+	}
+}
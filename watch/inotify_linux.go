@@ -0,0 +1,21 @@
+package watch
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Reads the named inotify limit from /proc/sys/fs/inotify.
+func inotifyLimit(name string) (int, bool) {
+	b, err := ioutil.ReadFile(filepath.Join("/proc/sys/fs/inotify", name))
+	if err != nil {
+		return 0, false
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, false
+	}
+	return limit, true
+}
@@ -0,0 +1,16 @@
+package watch
+
+import (
+	"testing"
+)
+
+func Test_inotifyLimit(t *testing.T) {
+	for _, name := range []string{"max_user_watches", "max_user_instances"} {
+		if limit, ok := inotifyLimit(name); !ok || limit <= 0 {
+			t.Errorf("inotifyLimit(%s); expected a positive limit, got %d %v", name, limit, ok)
+		}
+	}
+	if _, ok := inotifyLimit("no_such_limit"); ok {
+		t.Errorf("inotifyLimit(); expected no limit for an unknown name")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+// Reads the named inotify limit. There's no inotify outside of Linux.
+func inotifyLimit(_ string) (int, bool) {
+	return 0, false
+}
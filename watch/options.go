@@ -0,0 +1,179 @@
+package watch
+
+import (
+	"time"
+)
+
+// The defaults for the options that aren't given.
+const (
+	DefaultDebounceCount    int           = 15
+	DefaultDebounceInterval time.Duration = 1 * time.Second
+	DefaultPollInterval     time.Duration = 500 * time.Millisecond
+
+	// Attribute changes are left out by default because tools touch and
+	// chmod files far more often than the changes matter.
+	DefaultEvents EventType = Create | Write | Remove | Rename
+)
+
+// A Logger receives diagnostic messages. A *log.Logger is a Logger. Loggers
+// that also implement RecordLogger receive typed Records instead.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// A Logger that discards everything.
+type discardLogger struct{}
+
+func (discardLogger) Printf(_ string, _ ...interface{}) {}
+
+// An Option configures a DirWatcher or a Watcher. Watchers ignore the options
+// that don't apply to them.
+type Option func(*config)
+
+// The configuration built from a set of Options.
+type config struct {
+	filter           Filter
+	reasonFilter     reasonFilter
+	gitIgnore        bool
+	watcher          Watcher
+	poll             bool
+	pollFallback     bool
+	pollInterval     time.Duration
+	debounceCount    int
+	debounceInterval time.Duration
+	symlinks         SymlinkPolicy
+	rawEvents        bool
+	events           EventType
+	logger           Logger
+}
+
+// Builds the configuration for the given Options on top of the defaults.
+func newConfig(opts []Option) config {
+	c := config{
+		filter:           noFilter,
+		pollInterval:     DefaultPollInterval,
+		debounceCount:    DefaultDebounceCount,
+		debounceInterval: DefaultDebounceInterval,
+		symlinks:         SymlinkIgnore,
+		events:           DefaultEvents,
+		logger:           discardLogger{},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithFilter filters out the events for which filter returns true. It can be
+// combined with WithGitIgnore in which case an event is filtered out if
+// either filter says so.
+func WithFilter(filter Filter) Option {
+	return func(c *config) {
+		if filter != nil {
+			c.filter = filter
+		}
+	}
+}
+
+// Makes a Watcher filter events with a reasonFilter. It takes precedence over
+// WithFilter.
+func withReasonFilter(filter reasonFilter) Option {
+	return func(c *config) {
+		c.reasonFilter = filter
+	}
+}
+
+// Returns the reasonFilter a Watcher filters events with.
+func (c config) eventFilter() reasonFilter {
+	if c.reasonFilter != nil {
+		return c.reasonFilter
+	}
+	return withReason(ReasonFilter, c.filter)
+}
+
+// WithGitIgnore filters out events for paths that are ignored by the git
+// repository of the root they're in. Individually watched files are never
+// filtered out this way. The option has no effect when git isn't installed.
+func WithGitIgnore() Option {
+	return func(c *config) {
+		c.gitIgnore = true
+	}
+}
+
+// WithWatcher makes a DirWatcher use the given Watcher rather than creating
+// one. The DirWatcher takes ownership of the Watcher and stops it when it's
+// done. The options that configure the created Watcher have no effect.
+func WithWatcher(w Watcher) Option {
+	return func(c *config) {
+		c.watcher = w
+	}
+}
+
+// WithPolling makes a DirWatcher poll for changes rather than use file system
+// notifications. Without it a DirWatcher polls only when a path is on a file
+// system known not to deliver notifications.
+func WithPolling() Option {
+	return func(c *config) {
+		c.poll = true
+	}
+}
+
+// WithPollFallback makes a DirWatcher poll the directories that can't be
+// watched because the system ran out of notification watches.
+func WithPollFallback() Option {
+	return func(c *config) {
+		c.pollFallback = true
+	}
+}
+
+// WithPollInterval sets the interval between polls when polling.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *config) {
+		if interval > 0 {
+			c.pollInterval = interval
+		}
+	}
+}
+
+// WithDebounce sets the maximum number of events collected into a Changeset
+// and the interval within which subsequent events must arrive to be collected.
+func WithDebounce(count int, interval time.Duration) Option {
+	return func(c *config) {
+		c.debounceCount = count
+		c.debounceInterval = interval
+	}
+}
+
+// WithSymlinks sets the policy for following symlinked directories.
+func WithSymlinks(policy SymlinkPolicy) Option {
+	return func(c *config) {
+		c.symlinks = policy
+	}
+}
+
+// WithRawEvents makes a DirWatcher report events as the Watcher raises them.
+// By default the events for the temporary and backup files editors create
+// while saving are dropped, and a file replaced by an atomic save is reported
+// as written rather than as renamed, created, and removed.
+func WithRawEvents() Option {
+	return func(c *config) {
+		c.rawEvents = true
+	}
+}
+
+// WithEvents sets the event types a DirWatcher reports in its Changesets.
+func WithEvents(types EventType) Option {
+	return func(c *config) {
+		c.events = types
+	}
+}
+
+// WithLogger sends diagnostic messages to the given Logger. They're discarded
+// by default.
+func WithLogger(logger Logger) Option {
+	return func(c *config) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
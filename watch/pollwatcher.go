@@ -0,0 +1,228 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewPollWatcher creates a new Watcher that detects changes by periodically
+// comparing stat info rather than relying on kernel notifications. It works
+// on file systems that never deliver inotify events such as NFS, some FUSE
+// mounts, and bind mounts shared into containers from a VM. It applies the
+// WithFilter, WithPollInterval, and WithLogger options.
+func NewPollWatcher(opts ...Option) Watcher {
+	c := newConfig(opts)
+	w := &pollWatcher{
+		interval: c.pollInterval,
+		filter:   c.eventFilter(),
+		logger:   c.logger,
+		events:   make(chan WatcherEvent, 1),
+		watched:  map[string]snapshot{},
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.start()
+	return w
+}
+
+// An implementation of Watcher that polls stat info.
+type pollWatcher struct {
+	interval time.Duration
+	filter   reasonFilter
+	logger   Logger
+	events   chan WatcherEvent
+
+	// The watched paths mapped to the last snapshot taken of each.
+	watched map[string]snapshot
+	mu      sync.Mutex
+
+	// Closed by Stop to tell start to return, and by start when it has.
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// The stat info we compare between polls to detect a change.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+	dev     uint64
+	ino     uint64
+}
+
+// A snapshot maps a watched path, and its entries when it's a directory, to
+// their fileState.
+type snapshot map[string]fileState
+
+// Tells the watcher to begin watching the given file or directory (not recursive).
+func (w *pollWatcher) Watch(path string) error {
+	snap, err := takeSnapshot(path)
+	if err != nil {
+		return fmt.Errorf("failed to add watcher: %v", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watched[path] = snap
+	return nil
+}
+
+// Stops watching the given file or directory.
+func (w *pollWatcher) Unwatch(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watched[path]; !ok {
+		return fmt.Errorf("failed to remove watcher: %s is not watched", path)
+	}
+	delete(w.watched, path)
+	return nil
+}
+
+// The channel that the watcher communicates events and errors on.
+func (w *pollWatcher) Events() <-chan WatcherEvent {
+	return w.events
+}
+
+// Stops the Watcher.
+func (w *pollWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.stopped
+}
+
+// Polls the watched paths until the watcher is stopped.
+func (w *pollWatcher) start() {
+	defer close(w.stopped)
+	defer close(w.events)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			for _, event := range w.poll() {
+				if skipEvent(w.filter, event, w.logger) {
+					continue
+				}
+				select {
+				case w.events <- WatcherEvent{Event: event}:
+				case <-w.stop:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Takes a new snapshot of each watched path and returns the events that
+// describe the differences from the previous one.
+func (w *pollWatcher) poll() []FsEvent {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.watched))
+	for path := range w.watched {
+		paths = append(paths, path)
+	}
+	w.mu.Unlock()
+	sort.Strings(paths)
+
+	events := []FsEvent{}
+	for _, path := range paths {
+		snap, err := takeSnapshot(path)
+		if err != nil && !os.IsNotExist(err) {
+			logRecord(w.logger, newRecord(RecordError, Fields{"path": path, "error": err.Error()},
+				"poll watcher stat error: %s %v", path, err).at(LevelWarn))
+			continue
+		}
+		w.mu.Lock()
+		prev, ok := w.watched[path]
+		if ok {
+			if err != nil {
+				// Like inotify, the watch goes away with the watched path.
+				delete(w.watched, path)
+			} else {
+				w.watched[path] = snap
+			}
+		}
+		w.mu.Unlock()
+		if ok {
+			events = append(events, diffSnapshots(prev, snap)...)
+		}
+	}
+	return events
+}
+
+// Stats the given path and, if it's a directory, its immediate entries.
+func takeSnapshot(path string) (snapshot, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	snap := snapshot{path: newFileState(fi)}
+	if !fi.IsDir() {
+		return snap, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The entry was removed since we read the directory.
+			continue
+		}
+		snap[filepath.Join(path, entry.Name())] = newFileState(info)
+	}
+	return snap, nil
+}
+
+// Creates the fileState for the given FileInfo.
+func newFileState(fi os.FileInfo) fileState {
+	state := fileState{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		mode:    fi.Mode(),
+	}
+	state.dev, state.ino, _ = fileID(fi)
+	return state
+}
+
+// Describes the differences between two snapshots as file system events.
+func diffSnapshots(prev, next snapshot) []FsEvent {
+	now := time.Now()
+	events := []FsEvent{}
+	for path, state := range next {
+		old, ok := prev[path]
+		switch {
+		case !ok || old.dev != state.dev || old.ino != state.ino || old.mode.IsDir() != state.mode.IsDir():
+			// A new inode at the path means the entry was replaced.
+			events = append(events, FsEvent{Path: path, Type: Create, Time: now})
+		default:
+			var t EventType
+			// A directory's mtime changes with its entries which are
+			// reported by the watch on the directory itself.
+			if !state.mode.IsDir() && (!old.modTime.Equal(state.modTime) || old.size != state.size) {
+				t |= Write
+			}
+			if old.mode != state.mode {
+				t |= Attrib
+			}
+			if t != 0 {
+				events = append(events, FsEvent{Path: path, Type: t, Time: now})
+			}
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			events = append(events, FsEvent{Path: path, Type: Remove, Time: now})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
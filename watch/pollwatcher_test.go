@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_pollWatcher(t *testing.T) {
+
+	t.Run("Stop returns while an event is waiting to be consumed", func(t *testing.T) {
+		dir := t.TempDir()
+		w := NewPollWatcher(WithPollInterval(time.Millisecond))
+		if err := w.Watch(dir); err != nil {
+			t.Fatalf("unexpected error from Watch(): %+v", err)
+		}
+		for _, name := range []string{"a", "b", "c"} {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		stopped := make(chan struct{})
+		go func() {
+			w.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Stop(); timed out waiting for the Watcher to stop")
+		}
+		for range w.Events() {
+		}
+	})
+}
+
+func Test_diffSnapshots(t *testing.T) {
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Reports created, written, replaced, removed and chmodded entries", func(t *testing.T) {
+		prev := snapshot{
+			"/foo":           {modTime: mtime, mode: os.ModeDir | 0755, ino: 1},
+			"/foo/written":   {modTime: mtime, size: 1, ino: 2},
+			"/foo/replaced":  {modTime: mtime, size: 1, ino: 3},
+			"/foo/removed":   {modTime: mtime, size: 1, ino: 4},
+			"/foo/unchanged": {modTime: mtime, size: 1, ino: 5},
+			"/foo/chmodded":  {modTime: mtime, size: 1, mode: 0644, ino: 8},
+			"/foo/bar":       {modTime: mtime, mode: os.ModeDir | 0755, ino: 9},
+		}
+		next := snapshot{
+			"/foo":           {modTime: mtime.Add(time.Second), mode: os.ModeDir | 0755, ino: 1},
+			"/foo/written":   {modTime: mtime.Add(time.Second), size: 2, ino: 2},
+			"/foo/replaced":  {modTime: mtime, size: 1, ino: 6},
+			"/foo/unchanged": {modTime: mtime, size: 1, ino: 5},
+			"/foo/created":   {modTime: mtime, size: 1, ino: 7},
+			"/foo/chmodded":  {modTime: mtime, size: 1, mode: 0755, ino: 8},
+			"/foo/bar":       {modTime: mtime, mode: os.ModeDir | 0700, ino: 9},
+		}
+		expected := map[string]EventType{
+			"/foo/created":  Create,
+			"/foo/removed":  Remove,
+			"/foo/replaced": Create,
+			"/foo/written":  Write,
+			"/foo/chmodded": Attrib,
+			"/foo/bar":      Attrib,
+		}
+		actual := map[string]EventType{}
+		for _, event := range diffSnapshots(prev, next) {
+			actual[event.Path] |= event.Type
+		}
+		if len(actual) != len(expected) {
+			t.Errorf("diffSnapshots(); expected %+v, got %+v", expected, actual)
+		}
+		for path, typ := range expected {
+			if actual[path] != typ {
+				t.Errorf("diffSnapshots(); expected %s %v, got %v", path, typ, actual[path])
+			}
+		}
+	})
+}
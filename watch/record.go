@@ -0,0 +1,145 @@
+package watch
+
+import (
+	"fmt"
+)
+
+// A RecordType classifies a Record.
+type RecordType string
+
+// The types of the Records the package logs.
+const (
+	// RecordFsEvent is an event raised by the Watcher.
+	RecordFsEvent RecordType = "fs_event"
+
+	// RecordFilter is an event being filtered out, with the reason.
+	RecordFilter RecordType = "filter"
+
+	// RecordDebounce is a debounce window closing into a Changeset.
+	RecordDebounce RecordType = "debounce"
+
+	// RecordWatch is a directory being watched or unwatched.
+	RecordWatch RecordType = "watch"
+
+	// RecordError is an error that didn't stop watching.
+	RecordError RecordType = "error"
+
+	// RecordInfo is anything else.
+	RecordInfo RecordType = "info"
+)
+
+// A Level is the importance of a Record. Lower levels are more important.
+type Level int
+
+// The levels of Records.
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	case LevelTrace:
+		return "trace"
+	}
+	return "unknown"
+}
+
+// The level of each type of Record unless it's given another.
+var defaultLevels = map[RecordType]Level{
+	RecordFsEvent:  LevelDebug,
+	RecordFilter:   LevelDebug,
+	RecordDebounce: LevelDebug,
+	RecordWatch:    LevelInfo,
+	RecordError:    LevelError,
+	RecordInfo:     LevelInfo,
+}
+
+// The reasons given by RecordFilter Records.
+const (
+	// The filter given by WithFilter filtered the event out.
+	ReasonFilter = "filter"
+
+	// The path is ignored by git.
+	ReasonGitIgnore = "gitignore"
+
+	// The path is a temporary file created by an editor while saving.
+	ReasonEditorTemp = "editor_temp"
+
+	// The path is in a directory that's watched only for other files in it.
+	ReasonNotWatched = "not_watched"
+
+	// The event's types aren't among those given by WithEvents.
+	ReasonEventType = "event_type"
+)
+
+// Fields holds the typed values of a Record.
+type Fields map[string]interface{}
+
+// A Record is a diagnostic message with typed fields that describe it.
+type Record struct {
+
+	// The kind of Record which determines its fields.
+	Type RecordType
+
+	// The importance of the Record.
+	Level Level
+
+	// The message as a Logger that doesn't take Records would print it.
+	Message string
+
+	// The values the message describes, possibly nil.
+	Fields Fields
+}
+
+// A RecordLogger is a Logger that takes Records. The DirWatcher and Watchers
+// log Records to Loggers that implement RecordLogger and the Records' messages
+// to those that don't.
+type RecordLogger interface {
+	Logger
+	LogRecord(Record)
+}
+
+// Creates a Record with a formatted message at the default level for its
+// type.
+func newRecord(t RecordType, fields Fields, format string, v ...interface{}) Record {
+	level, ok := defaultLevels[t]
+	if !ok {
+		level = LevelInfo
+	}
+	return Record{
+		Type:    t,
+		Level:   level,
+		Message: fmt.Sprintf(format, v...),
+		Fields:  fields,
+	}
+}
+
+// Returns the Record at the given level.
+func (r Record) at(level Level) Record {
+	r.Level = level
+	return r
+}
+
+// Logs a Record to the given Logger, possibly nil.
+func logRecord(logger Logger, r Record) {
+	if logger == nil {
+		return
+	}
+	if rl, ok := logger.(RecordLogger); ok {
+		rl.LogRecord(r)
+		return
+	}
+	logger.Printf("%s\n", r.Message)
+}
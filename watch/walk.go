@@ -0,0 +1,224 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A SymlinkPolicy controls which symlinked directories are followed when
+// walking a directory tree.
+type SymlinkPolicy int
+
+const (
+	// SymlinkIgnore doesn't follow symlinked directories.
+	SymlinkIgnore SymlinkPolicy = iota
+
+	// SymlinkConfine follows symlinked directories whose targets are inside
+	// one of the watched roots.
+	SymlinkConfine
+
+	// SymlinkAllow follows symlinked directories wherever their targets are.
+	SymlinkAllow
+)
+
+// A dirWalker walks directory trees in the real file system, following
+// symlinked directories according to its policy.
+type dirWalker struct {
+
+	// The policy for following symlinked directories.
+	symlinks SymlinkPolicy
+
+	// The watched roots that SymlinkConfine confines targets to.
+	roots []string
+
+	// The Logger for diagnostic messages, possibly nil.
+	logger Logger
+}
+
+// Walks the directory tree at root calling walkFn on each directory path.
+func (w dirWalker) walk(root string, walkFn func(string) error) error {
+	if w.symlinks == SymlinkIgnore {
+		return w.walkDirs(root, walkFn)
+	}
+	fi, err := os.Lstat(root)
+	if err != nil {
+		w.log(newRecord(RecordError, Fields{"path": root, "error": err.Error()}, "watchdir walk error: %v", err))
+		return err
+	}
+	walk := symlinkWalk{
+		dirWalker: w,
+		realRoots: w.realRoots(),
+		visited:   map[string]bool{},
+		walkFn:    walkFn,
+	}
+	if err := walk.walkEntry(root, fi); err != nil {
+		return err
+	}
+	// The links are followed once the real directories have been walked so a
+	// directory is registered under its own path rather than an alias that
+	// could be removed while the directory stays.
+	for len(walk.links) > 0 {
+		link := walk.links[0]
+		walk.links = walk.links[1:]
+		if err := walk.followLink(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walks the tree with filepath.Walk which never follows symlinks.
+func (w dirWalker) walkDirs(root string, walkFn func(string) error) error {
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			w.log(newRecord(RecordError, Fields{"path": p, "error": err.Error()}, "watchdir walk error: %v", err))
+			return err
+		}
+		if fi.IsDir() {
+			return walkFn(p)
+		}
+		return nil
+	})
+}
+
+// Writes a Record to the Logger if there is one.
+func (w dirWalker) log(r Record) {
+	logRecord(w.logger, r)
+}
+
+// Resolves the symlinks in the roots.
+func (w dirWalker) realRoots() []string {
+	realRoots := make([]string, 0, len(w.roots))
+	for _, root := range w.roots {
+		real, err := realPath(root)
+		if err != nil {
+			w.log(newRecord(RecordError, Fields{"path": root, "error": err.Error()}, "watchdir walk error: %v", err).at(LevelWarn))
+			continue
+		}
+		realRoots = append(realRoots, real)
+	}
+	return realRoots
+}
+
+// The state of a single walk that follows symlinks.
+type symlinkWalk struct {
+	dirWalker
+	realRoots []string
+
+	// The directories visited so far, keyed by device and inode, so that we
+	// don't loop or watch a directory twice when links lead back into the
+	// tree.
+	visited map[string]bool
+
+	// The symlinks found so far that are yet to be followed.
+	links []string
+
+	walkFn func(string) error
+}
+
+// Walks the entry at path which is described by fi, setting symlinks aside to
+// be followed later.
+func (walk *symlinkWalk) walkEntry(path string, fi os.FileInfo) error {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		walk.links = append(walk.links, path)
+		return nil
+	}
+	if !fi.IsDir() {
+		return nil
+	}
+	return walk.walkDir(path, fi)
+}
+
+// Follows the symlink at path if the policy allows it and it leads to a
+// directory.
+func (walk *symlinkWalk) followLink(path string) error {
+	if !walk.follow(path) {
+		return nil
+	}
+	target, err := os.Stat(path)
+	if err != nil {
+		// A dangling link isn't a reason to stop watching.
+		walk.log(newRecord(RecordInfo, Fields{"path": path, "error": err.Error()},
+			"watchdir walk: not following %s: %v", path, err).at(LevelDebug))
+		return nil
+	}
+	if !target.IsDir() {
+		return nil
+	}
+	return walk.walkDir(path, target)
+}
+
+// Walks the directory at path which is described by fi.
+func (walk *symlinkWalk) walkDir(path string, fi os.FileInfo) error {
+	key := dirKey(path, fi)
+	if walk.visited[key] {
+		walk.log(newRecord(RecordInfo, Fields{"path": path}, "watchdir walk: %s was already visited", path).at(LevelTrace))
+		return nil
+	}
+	walk.visited[key] = true
+
+	if err := walk.walkFn(path); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		walk.log(newRecord(RecordError, Fields{"path": path, "error": err.Error()}, "watchdir walk error: %v", err))
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The entry was removed since we read the directory.
+			continue
+		}
+		if err := walk.walkEntry(filepath.Join(path, entry.Name()), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Indicates whether the symlink at path should be followed.
+func (walk *symlinkWalk) follow(path string) bool {
+	if walk.symlinks == SymlinkAllow {
+		return true
+	}
+	target, err := realPath(path)
+	if err != nil {
+		walk.log(newRecord(RecordInfo, Fields{"path": path, "error": err.Error()},
+			"watchdir walk: not following %s: %v", path, err).at(LevelDebug))
+		return false
+	}
+	for _, root := range walk.realRoots {
+		if pathWithin(target, root) {
+			return true
+		}
+	}
+	walk.log(newRecord(RecordInfo, Fields{"path": path, "target": target},
+		"watchdir walk: not following %s to %s outside of the watched roots", path, target))
+	return false
+}
+
+// Resolves the symlinks in path and makes it absolute.
+func realPath(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(real)
+}
+
+// Creates a key that identifies the directory at path which is described by
+// fi. We use the device and inode where they're available and fall back to
+// the resolved path.
+func dirKey(path string, fi os.FileInfo) string {
+	if dev, ino, ok := fileID(fi); ok {
+		return fmt.Sprintf("%d:%d", dev, ino)
+	}
+	if real, err := realPath(path); err == nil {
+		return real
+	}
+	return filepath.Clean(path)
+}
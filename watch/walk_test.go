@@ -0,0 +1,152 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func Test_dirWalker(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires privileges on Windows")
+	}
+
+	// Creates the tree:
+	//   root/a/
+	//   root/a/loop -> root/
+	//   root/linked -> root/a/
+	//   root/outside -> other/
+	//   other/b/
+	setup := func(t *testing.T) (string, string) {
+		dir := t.TempDir()
+		root := filepath.Join(dir, "root")
+		other := filepath.Join(dir, "other")
+		for _, path := range []string{filepath.Join(root, "a"), filepath.Join(other, "b")} {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		links := map[string]string{
+			filepath.Join(root, "a", "loop"): root,
+			filepath.Join(root, "linked"):    filepath.Join(root, "a"),
+			filepath.Join(root, "outside"):   other,
+		}
+		for link, target := range links {
+			if err := os.Symlink(target, link); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root, other
+	}
+
+	walk := func(t *testing.T, w dirWalker, root string) []string {
+		walked := []string{}
+		if err := w.walk(root, func(path string) error {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			walked = append(walked, rel)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from walk(): %+v", err)
+		}
+		return walked
+	}
+
+	t.Run("Does not follow symlinks by default", func(t *testing.T) {
+		root, _ := setup(t)
+		expected := []string{".", "a"}
+		actual := walk(t, dirWalker{symlinks: SymlinkIgnore, roots: []string{root}}, root)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("walk(); expected %+v, got %+v", expected, actual)
+		}
+	})
+
+	t.Run("Confines symlinks to the roots without looping", func(t *testing.T) {
+		root, _ := setup(t)
+		expected := []string{".", "a"}
+		actual := walk(t, dirWalker{symlinks: SymlinkConfine, roots: []string{root}}, root)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("walk(); expected %+v, got %+v", expected, actual)
+		}
+	})
+
+	t.Run("Follows symlinks outside of the roots when allowed", func(t *testing.T) {
+		root, _ := setup(t)
+		expected := []string{".", "a", "outside", "outside/b"}
+		actual := walk(t, dirWalker{symlinks: SymlinkAllow, roots: []string{root}}, root)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("walk(); expected %+v, got %+v", expected, actual)
+		}
+	})
+
+	t.Run("Follows symlinks into other roots when confined", func(t *testing.T) {
+		root, other := setup(t)
+		expected := []string{".", "a", "outside", "outside/b"}
+		actual := walk(t, dirWalker{symlinks: SymlinkConfine, roots: []string{root, other}}, root)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("walk(); expected %+v, got %+v", expected, actual)
+		}
+	})
+
+	t.Run("Keeps watching a real directory after a link to it is removed", func(t *testing.T) {
+		// The link sorts before its target so it's found first.
+		root := t.TempDir()
+		real := filepath.Join(root, "real")
+		link := filepath.Join(root, "link")
+		if err := os.MkdirAll(filepath.Join(real, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(real, link); err != nil {
+			t.Fatal(err)
+		}
+		unwatched := []string{}
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(path string) error {
+				unwatched = append(unwatched, path)
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: dirWalker{symlinks: SymlinkConfine, roots: []string{root}}.walk,
+			isDir:    isDir,
+			watcher:  watcher,
+		}
+		written := filepath.Join(real, "sub", "f2")
+		go func() {
+			if err := os.Remove(link); err != nil {
+				t.Error(err)
+			}
+			watcher.events <- WatcherEvent{Event: FsEvent{Path: link, Type: Remove}}
+			if err := os.WriteFile(written, nil, 0644); err != nil {
+				t.Error(err)
+			}
+			watcher.events <- WatcherEvent{Event: FsEvent{Path: written, Type: Write}}
+			close(watcher.events)
+		}()
+		changed := []string{}
+		if err := dw.watch(context.Background(), []string{root}, nil, func(c Changeset) error {
+			changed = append(changed, c.Paths()...)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if len(unwatched) != 0 {
+			t.Errorf("expected no directories to be unwatched, got %+v", unwatched)
+		}
+		expected := []string{root, real, filepath.Join(real, "sub")}
+		if actual := dw.Watched(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Watched(); expected %+v, got %+v", expected, actual)
+		}
+		if expected := []string{link, written}; !reflect.DeepEqual(expected, changed) {
+			t.Errorf("handle(); expected changes to %+v, got %+v", expected, changed)
+		}
+	})
+}
@@ -0,0 +1,631 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Handler is a function that handles the Changeset produced by each
+// debounce window of a DirWatcher.
+type Handler func(Changeset) error
+
+// Watch creates a DirWatcher for the given paths and watches them until ctx is
+// done or watching fails. See New and DirWatcher.Watch.
+func Watch(ctx context.Context, paths []string, handle Handler, opts ...Option) error {
+	dw, err := New(paths, opts...)
+	if err != nil {
+		return err
+	}
+	return dw.Watch(ctx, handle)
+}
+
+// New creates a DirWatcher for the given paths. Directories are watched
+// recursively and files are watched individually. Unless the WithWatcher
+// option is given New creates the Watcher for the DirWatcher, polling when
+// asked to or when a path is on a file system that doesn't deliver
+// notifications.
+func New(paths []string, opts ...Option) (*DirWatcher, error) {
+	return newDirWatcher(paths, newConfig(opts), true)
+}
+
+// NewDryRun creates a DirWatcher for the given paths that can Plan and
+// Explain but not Watch. It doesn't create a Watcher so it takes none of the
+// system's watch resources.
+func NewDryRun(paths []string, opts ...Option) (*DirWatcher, error) {
+	return newDirWatcher(paths, newConfig(opts), false)
+}
+
+// Creates a DirWatcher for the given paths, and the Watcher for it unless the
+// configuration has one or create is false.
+func newDirWatcher(paths []string, c config, create bool) (*DirWatcher, error) {
+	roots, files := []string{}, []string{}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		if fi.IsDir() {
+			roots = append(roots, path)
+		} else {
+			files = append(files, path)
+		}
+	}
+	watcher := c.watcher
+	if watcher == nil && create {
+		var err error
+		if watcher, err = newWatcher(c, roots, files); err != nil {
+			return nil, err
+		}
+	}
+	walker := dirWalker{
+		symlinks: c.symlinks,
+		roots:    roots,
+		logger:   c.logger,
+	}
+	// The filters are applied by the Watcher we create; a given Watcher does
+	// its own filtering.
+	var filter Filter
+	if c.watcher == nil {
+		filter = c.filter
+	}
+	return &DirWatcher{
+		walkDirs:         walker.walk,
+		isDir:            isDir,
+		watcher:          watcher,
+		debounceCount:    c.debounceCount,
+		debounceInterval: c.debounceInterval,
+		logger:           c.logger,
+		normalize:        !c.rawEvents,
+		ignored:          allEventTypes &^ c.events,
+		symlinks:         c.symlinks,
+		filter:           filter,
+		gitIgnore:        c.gitIgnore && c.watcher == nil && GitIgnoreSupported(),
+		roots:            roots,
+		filePaths:        files,
+		watched:          map[string]string{},
+		files:            map[string]string{},
+		fileDirs:         map[string]string{},
+	}, nil
+}
+
+// Creates the Watcher described by the configuration for the given roots and
+// files.
+func newWatcher(c config, roots []string, files []string) (Watcher, error) {
+	filters := []reasonFilter{withReason(ReasonFilter, c.filter)}
+	if c.gitIgnore {
+		if GitIgnoreSupported() {
+			logRecord(c.logger, newRecord(RecordInfo, nil, "using .gitignore filter"))
+			filters = append(filters, withReason(ReasonGitIgnore, gitIgnoreFilter(roots, files)))
+		} else {
+			logRecord(c.logger, newRecord(RecordInfo, nil, "gitignore not supported: git was not found"))
+		}
+	}
+	opts := []Option{
+		withReasonFilter(firstReason(filters...)),
+		WithPollInterval(c.pollInterval),
+		WithLogger(c.logger),
+	}
+
+	poll := c.poll
+	for _, paths := range [][]string{roots, files} {
+		for _, path := range paths {
+			if poll {
+				break
+			}
+			needsPolling, fs, err := NeedsPolling(path)
+			if err != nil {
+				logRecord(c.logger, newRecord(RecordError, Fields{"path": path, "error": err.Error()},
+					"statfs error: %s %v", path, err).at(LevelWarn))
+			} else if needsPolling {
+				logRecord(c.logger, newRecord(RecordInfo, Fields{"path": path, "fs": fs},
+					"%s is on %s which does not support file system notifications, polling for changes", path, fs).at(LevelWarn))
+				poll = true
+			}
+		}
+	}
+	if poll {
+		return NewPollWatcher(opts...), nil
+	}
+
+	watcher, err := NewWatcher(opts...)
+	switch {
+	case err != nil && IsWatchLimit(err) && c.pollFallback:
+		logRecord(c.logger, newRecord(RecordError, Fields{"error": err.Error()},
+			"failed to create watcher, polling for changes: %v", err).at(LevelWarn))
+		return NewPollWatcher(opts...), nil
+	case err != nil && IsWatchLimit(err):
+		return nil, newWatchLimitError(0, err)
+	case err != nil:
+		return nil, err
+	case c.pollFallback:
+		return NewFallbackWatcher(watcher, NewPollWatcher(opts...), opts...), nil
+	}
+	return watcher, nil
+}
+
+// A DirWatcher watches directory trees and individual files, reporting the
+// changes to them as debounced Changesets.
+type DirWatcher struct {
+
+	// A function that walks the directory tree of a given directory path and
+	// calls a given function on each directory path.
+	walkDirs func(string, func(string) error) error
+
+	// A function that tests whether a given path refers to a directory.
+	isDir func(string) bool
+
+	// The Watcher to use to detect file system changes.
+	watcher Watcher
+
+	// The max number of events to debounce.
+	debounceCount int
+
+	// The interval within which subsequent events must occur to trigger
+	// debouncing.
+	debounceInterval time.Duration
+
+	// The Logger for diagnostic messages, possibly nil.
+	logger Logger
+
+	// Whether to drop the events for editors' temporary files and fold the
+	// events of atomic saves into writes.
+	normalize bool
+
+	// The event types left out of Changesets.
+	ignored EventType
+
+	// The policy the directory walk follows symlinks by.
+	symlinks SymlinkPolicy
+
+	// The filter the Watcher applies, possibly nil, and whether it also
+	// applies the gitignore rules. These are only used by Explain.
+	filter    Filter
+	gitIgnore bool
+
+	// The root directories being watched.
+	roots []string
+
+	// The paths of the individual files being watched.
+	filePaths []string
+
+	// Guards writes to the registries below and reads from other goroutines
+	// than the one running Watch, which is the only one that writes to them.
+	mu sync.RWMutex
+
+	// The registry of watched directories. The keys are the cleaned paths
+	// and the values are the paths as they were passed to the Watcher.
+	watched map[string]string
+
+	// The individually watched files, keyed by their cleaned paths.
+	files map[string]string
+
+	// The directories that are watched only for the individual files in them,
+	// keyed by their cleaned paths. Events for other entries in them are
+	// dropped.
+	fileDirs map[string]string
+}
+
+// Watch watches for changes and calls handle with the Changeset of each
+// debounce window until ctx is done, the Watcher stops, watching a new
+// directory fails, or handle returns an error. When ctx is done Watch returns
+// ctx.Err(). The Watcher is stopped when Watch returns.
+func (dw *DirWatcher) Watch(ctx context.Context, handle Handler) error {
+	if dw.watcher == nil {
+		return errors.New("a DirWatcher created by NewDryRun can't watch")
+	}
+	defer dw.watcher.Stop()
+	return dw.watch(ctx, dw.roots, dw.filePaths, handle)
+}
+
+// Watched returns the directories being watched in lexical order, including
+// those watched only for the individual files in them. It's safe to call
+// while Watch is running.
+func (dw *DirWatcher) Watched() []string {
+	dw.mu.RLock()
+	defer dw.mu.RUnlock()
+	dirs := make([]string, 0, len(dw.watched)+len(dw.fileDirs))
+	for _, path := range dw.watched {
+		dirs = append(dirs, path)
+	}
+	for key, path := range dw.fileDirs {
+		if _, ok := dw.watched[key]; !ok {
+			dirs = append(dirs, path)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Plan returns the directories Watch would watch in lexical order, walking
+// the roots the same way but without watching them.
+func (dw *DirWatcher) Plan() ([]string, error) {
+	dirs := map[string]string{}
+	for _, root := range dw.roots {
+		err := dw.walkDirs(root, func(path string) error {
+			dirs[filepath.Clean(path)] = path
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range dw.filePaths {
+		dir := filepath.Dir(file)
+		if _, ok := dirs[filepath.Clean(dir)]; !ok {
+			dirs[filepath.Clean(dir)] = dir
+		}
+	}
+	plan := make([]string, 0, len(dirs))
+	for _, path := range dirs {
+		plan = append(plan, path)
+	}
+	sort.Strings(plan)
+	return plan, nil
+}
+
+// Implements Watch for the given roots and files.
+func (dw *DirWatcher) watch(ctx context.Context, roots []string, files []string, handle Handler) error {
+	dw.roots = roots
+	for _, root := range roots {
+		if err := dw.watchDir(root); err != nil {
+			return err
+		}
+	}
+	// Files are watched after the roots so we know which of their directories
+	// are already watched.
+	for _, file := range files {
+		if err := dw.watchFile(file); err != nil {
+			return err
+		}
+	}
+	events := dw.watcher.Events()
+	for {
+		var event WatcherEvent
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			event = e
+		}
+
+		if !dw.inScope(event) {
+			continue
+		}
+
+		editorTemp := dw.isEditorTemp(event)
+		if err := dw.processEvent(event); err != nil {
+			return err
+		}
+		if editorTemp {
+			continue
+		}
+
+		event, ok := dw.mask(event)
+		if !ok {
+			continue
+		}
+
+		var changes Changeset
+		changes.add(event)
+		count := 1
+
+		// Debounce the event queue a bit. Our command will reflect the state
+		// of the system when it runs so rather than handling every event we
+		// collect the window into a single Changeset.
+	DEBOUNCE:
+		for i := 0; i < dw.debounceCount; i++ {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case e, ok := <-events:
+				if !ok {
+					break DEBOUNCE
+				}
+				if !dw.inScope(e) {
+					break
+				}
+				editorTemp := dw.isEditorTemp(e)
+				if err := dw.processEvent(e); err != nil {
+					return err
+				}
+				if editorTemp {
+					break
+				}
+				if e, ok := dw.mask(e); ok {
+					changes.add(e)
+					count++
+				}
+			case <-time.After(dw.debounceInterval):
+				break DEBOUNCE
+			}
+		}
+
+		if dw.normalize {
+			changes.foldAtomicSaves(os.Lstat)
+		}
+		dw.log(newRecord(RecordDebounce, Fields{
+			"events":     count,
+			"paths":      changes.Paths(),
+			"errors":     len(changes.Errors),
+			"overflowed": changes.Overflowed,
+			"start":      changes.Start,
+			"end":        changes.End,
+		}, "watchdir debounced %d events into %d changed paths", count, len(changes.Changes)))
+		if dw.normalize && len(changes.Changes) == 0 && len(changes.Errors) == 0 && !changes.Overflowed {
+			continue
+		}
+
+		if err := handle(changes); err != nil {
+			return err
+		}
+	}
+}
+
+// Writes a Record to the Logger if there is one.
+func (dw *DirWatcher) log(r Record) {
+	logRecord(dw.logger, r)
+}
+
+// Adds watchers to the given directory and all of its subdirectories.
+func (dw *DirWatcher) watchDir(dir string) error {
+	// When we run out of watches we finish the walk without watching so we
+	// can report how many watches the tree needs.
+	var limitErr error
+	unwatched := 0
+	err := dw.walkDirs(dir, func(path string) error {
+		if limitErr == nil {
+			err := dw.watchPath(path)
+			if err == nil || !IsWatchLimit(err) {
+				return err
+			}
+			limitErr = err
+		}
+		unwatched++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if limitErr != nil {
+		return newWatchLimitError(len(dw.watched)+unwatched, limitErr)
+	}
+	return nil
+}
+
+// Adds a watcher to the given directory and adds it to the registry.
+func (dw *DirWatcher) watchPath(path string) error {
+	if err := dw.watcher.Watch(path); err != nil {
+		return err
+	}
+	dw.log(newRecord(RecordWatch, Fields{"path": path, "action": "watch"}, "watchdir watching %s", path).at(LevelTrace))
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.watched == nil {
+		dw.watched = map[string]string{}
+	}
+	dw.watched[filepath.Clean(path)] = path
+	return nil
+}
+
+// Watches an individual file. We watch its directory rather than the file
+// itself because editors that save by renaming a new file over the old one
+// would leave a watch on the file pointing at the replaced inode.
+func (dw *DirWatcher) watchFile(file string) error {
+	if dw.files == nil {
+		dw.files = map[string]string{}
+	}
+	dw.files[filepath.Clean(file)] = file
+	dir := filepath.Dir(file)
+	key := filepath.Clean(dir)
+	if _, ok := dw.watched[key]; ok {
+		return nil
+	}
+	if _, ok := dw.fileDirs[key]; ok {
+		return nil
+	}
+	if err := dw.watcher.Watch(dir); err != nil {
+		return err
+	}
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.fileDirs == nil {
+		dw.fileDirs = map[string]string{}
+	}
+	dw.fileDirs[key] = dir
+	return nil
+}
+
+// Indicates whether an event belongs to the watched roots or files rather
+// than to another entry in a directory that's watched only for its files.
+func (dw *DirWatcher) inScope(event WatcherEvent) bool {
+	if event.Error != nil {
+		return true
+	}
+	key := filepath.Clean(event.Event.Path)
+	if _, ok := dw.files[key]; ok {
+		return true
+	}
+	for _, dir := range []string{key, filepath.Dir(key)} {
+		_, fileDir := dw.fileDirs[dir]
+		_, treeDir := dw.watched[dir]
+		if fileDir && !treeDir {
+			dw.log(newRecord(RecordFilter, eventFields(event.Event, Fields{"reason": ReasonNotWatched}),
+				"ignoring event %v for a file that isn't watched", event.Event))
+			return false
+		}
+	}
+	return true
+}
+
+// Indicates whether an event is for an editor's temporary file and should be
+// left out of Changesets when events are normalized. Directories with the
+// same names aren't temporary files; the DirWatcher still has to watch them
+// and the events under them are reported. This is checked before the event is
+// processed so that a directory that was removed is still known.
+func (dw *DirWatcher) isEditorTemp(event WatcherEvent) bool {
+	if !dw.normalize || event.Error != nil {
+		return false
+	}
+	key := filepath.Clean(event.Event.Path)
+	if _, ok := dw.files[key]; ok || !isEditorTempFile(key) {
+		return false
+	}
+	if _, ok := dw.watched[key]; ok || dw.isDir(key) {
+		return false
+	}
+	dw.log(newRecord(RecordFilter, eventFields(event.Event, Fields{"reason": ReasonEditorTemp}),
+		"ignoring editor temp file event %v", event.Event))
+	return true
+}
+
+// Removes the ignored types from an event and indicates whether any are left.
+// The DirWatcher still processes the events it leaves out of Changesets so
+// that it can track the directories.
+func (dw *DirWatcher) mask(event WatcherEvent) (WatcherEvent, bool) {
+	if event.Error != nil {
+		return event, true
+	}
+	t := event.Event.Type &^ dw.ignored
+	if t == 0 {
+		dw.log(newRecord(RecordFilter, eventFields(event.Event, Fields{"reason": ReasonEventType}),
+			"ignoring event %v of an unwatched type", event.Event).at(LevelTrace))
+		return event, false
+	}
+	event.Event.Type = t
+	return event, true
+}
+
+// Re-walks the roots after the Watcher dropped events so that directories
+// created during the overflow get watched and directories removed during it
+// are dropped from the registry.
+func (dw *DirWatcher) rescan() error {
+	seen := map[string]bool{}
+	for _, root := range dw.roots {
+		err := dw.walkDirs(root, func(path string) error {
+			key := filepath.Clean(path)
+			seen[key] = true
+			if _, ok := dw.watched[key]; ok {
+				return nil
+			}
+			dw.log(newRecord(RecordWatch, Fields{"path": path, "action": "watch"}, "watchdir rescan: watching %s", path).at(LevelDebug))
+			return dw.watchPath(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	stale := []string{}
+	for key := range dw.watched {
+		if !seen[key] {
+			stale = append(stale, dw.watched[key])
+		}
+	}
+	sort.Strings(stale)
+	for _, path := range stale {
+		dw.log(newRecord(RecordWatch, Fields{"path": path, "action": "unwatch"}, "watchdir rescan: unwatching %s", path).at(LevelDebug))
+		dw.unwatchDir(path)
+	}
+	return nil
+}
+
+// Removes the watchers from the given directory and all of its
+// subdirectories that are in the registry.
+func (dw *DirWatcher) unwatchDir(dir string) {
+	stale := []string{}
+	for key := range dw.watched {
+		if pathWithin(key, dir) {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	for _, key := range stale {
+		path := dw.watched[key]
+		dw.mu.Lock()
+		delete(dw.watched, key)
+		dw.mu.Unlock()
+		if _, ok := dw.fileDirs[key]; ok {
+			// The directory is still needed for the files in it.
+			continue
+		}
+		// The kernel drops the watch when a directory is deleted so failing
+		// to remove it here is expected.
+		if err := dw.watcher.Unwatch(path); err != nil {
+			dw.log(newRecord(RecordError, Fields{"path": path, "error": err.Error()},
+				"watchdir unwatch error: %s %v", path, err).at(LevelDebug))
+		}
+	}
+}
+
+// Encapsulates the DirWatcher's own handling of the event. This exists
+// primarily to separate the DirWatcher's handling from the Handler since the
+// latter is debounced and the former is not.
+func (dw *DirWatcher) processEvent(event WatcherEvent) error {
+	if event.Error != nil {
+		dw.log(newRecord(RecordError, Fields{"error": event.Error.Error()}, "watchdir error event: %v", event.Error).at(LevelDebug))
+		if errors.Is(event.Error, ErrOverflow) {
+			return dw.rescan()
+		}
+		return nil
+	}
+
+	dw.log(newRecord(RecordFsEvent, eventFields(event.Event, nil), "watchdir fs event: %v", event.Event))
+
+	// A directory that was removed or renamed away takes its subdirectories
+	// with it. When it was renamed within the tree we'll get a Create for the
+	// new path and watch it from scratch; keeping the old watches would leave
+	// them reporting events under stale names.
+	path := event.Event.Path
+	if event.Event.Type&(Remove|Rename) != 0 {
+		dw.unwatchDir(path)
+	}
+
+	if event.Event.Type&Create != 0 && dw.isDir(path) {
+		if err := dw.watchDir(path); err != nil {
+			dw.log(newRecord(RecordError, Fields{"path": path, "error": err.Error()},
+				"watchdir watch error: %s %v", path, err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Finds the innermost of the given roots that contains path.
+func rootFor(roots []string, path string) (string, bool) {
+	found := ""
+	for _, root := range roots {
+		if pathWithin(path, root) && (found == "" || pathWithin(root, found)) {
+			found = root
+		}
+	}
+	return found, found != ""
+}
+
+// Indicates whether path is dir or a path inside of it. Both paths are
+// compared lexically.
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Tests whether the given path is a directory in the real file system.
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return fi.IsDir()
+}
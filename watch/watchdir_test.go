@@ -0,0 +1,951 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func Test_WatchDir(t *testing.T) {
+
+	t.Run("Returns error when Watcher#Watch returns error", func(t *testing.T) {
+		expectedErr := errors.New("expected error")
+		watcher := &testWatcher{
+			watch: func(string) error { return expectedErr },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		close(watcher.events)
+		err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error {
+			t.Error("unxpected call to handle()")
+			return nil
+		})
+		if err != expectedErr {
+			t.Errorf("watchDir(); expected %+v, got %+v", expectedErr, err)
+		}
+	})
+
+	t.Run("Calls handle() with a Changeset for each undebounced event", func(t *testing.T) {
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		someError := errors.New("some error")
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/foo/bar/baz", Type: Create},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/bar/baz", Type: Remove},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{}, Error: someError,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		expectedChanges := []Changeset{
+			{Changes: map[string]EventType{"/foo/bar/baz": Create}},
+			{Changes: map[string]EventType{"/foo/bar/baz": Remove}},
+			{Errors: []error{someError}},
+		}
+		actualChanges := []Changeset{}
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(c Changeset) error {
+			actualChanges = append(actualChanges, c)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if len(deep.Equal(expectedChanges, actualChanges)) != 0 {
+			t.Errorf("handle(); expected %+v, got %+v", expectedChanges, actualChanges)
+		}
+	})
+
+	t.Run("Leaves ignored event types out of Changesets", func(t *testing.T) {
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+			ignored: Attrib,
+		}
+		events := []WatcherEvent{
+			{Event: FsEvent{Path: "/foo/chmodded", Type: Attrib}},
+			{Event: FsEvent{Path: "/foo/created", Type: Create | Attrib}},
+			{Event: FsEvent{Path: "/foo/written", Type: Write}},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		expectedChanges := []Changeset{
+			{Changes: map[string]EventType{"/foo/created": Create}},
+			{Changes: map[string]EventType{"/foo/written": Write}},
+		}
+		actualChanges := []Changeset{}
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(c Changeset) error {
+			actualChanges = append(actualChanges, c)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if len(deep.Equal(expectedChanges, actualChanges)) != 0 {
+			t.Errorf("handle(); expected %+v, got %+v", expectedChanges, actualChanges)
+		}
+	})
+
+	t.Run("Returns nil after handling events successfully", func(t *testing.T) {
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		expectedEvents := []WatcherEvent{
+			{Event: FsEvent{}, Error: nil},
+		}
+		go func() {
+			for _, event := range expectedEvents {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("watchDir(); expected nil, got %+v", err)
+		}
+	})
+
+	t.Run("Returns error when handle returns error", func(t *testing.T) {
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		expectedError := errors.New("some error")
+		events := []WatcherEvent{
+			{Event: FsEvent{}, Error: nil},
+			{Event: FsEvent{}, Error: nil},
+			{Event: FsEvent{}, Error: expectedError},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		handle := func(c Changeset) error {
+			if len(c.Errors) != 0 {
+				return c.Errors[0]
+			}
+			return nil
+		}
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, handle); err != expectedError {
+			t.Errorf("watchDir(); expected %+v, got %+v", expectedError, err)
+		}
+	})
+
+	t.Run("Returns the context error and stops the Watcher when cancelled", func(t *testing.T) {
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:            func(_ string) bool { return false },
+			watcher:          watcher,
+			roots:            []string{"/foo/"},
+			debounceCount:    DefaultDebounceCount,
+			debounceInterval: time.Hour,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			watcher.events <- WatcherEvent{Event: FsEvent{Path: "/foo/bar", Type: Write}}
+			cancel()
+		}()
+		err := dw.Watch(ctx, func(_ Changeset) error {
+			t.Error("unxpected call to handle()")
+			return nil
+		})
+		if err != context.Canceled {
+			t.Errorf("Watch(); expected %+v, got %+v", context.Canceled, err)
+		}
+		if _, ok := <-watcher.events; ok {
+			t.Errorf("Watch(); expected the Watcher to be stopped")
+		}
+	})
+
+	t.Run("Watches all sub-directories in the target directory", func(t *testing.T) {
+		expectedWatched := []string{"/foo/", "/foo/bar/", "/foo/baz/"}
+		actualWatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				for _, path := range expectedWatched {
+					if err := walkFn(path); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+				}
+				return nil
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		close(watcher.events)
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+	})
+
+	t.Run("Watches the sub-directories of every root", func(t *testing.T) {
+		expectedWatched := []string{"/foo/", "/foo/bar/", "/baz/", "/baz/qux/"}
+		actualWatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				tree := map[string][]string{
+					"/foo/": {"/foo/", "/foo/bar/"},
+					"/baz/": {"/baz/", "/baz/qux/"},
+				}
+				for _, path := range tree[dir] {
+					if err := walkFn(path); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+				}
+				return nil
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		close(watcher.events)
+		if err := dw.watch(context.Background(), []string{"/foo/", "/baz/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+	})
+
+	t.Run("Watches individual files through their directories", func(t *testing.T) {
+		expectedWatched := []string{"/foo/", "/etc"}
+		actualWatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir: func(path string) bool {
+				return path == "/etc/ssh"
+			},
+			watcher: watcher,
+		}
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/etc/passwd", Type: Write},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/etc/ssh", Type: Create},
+				Error: nil,
+			},
+			{
+				// The file was replaced by an editor renaming over it.
+				Event: FsEvent{Path: "/etc/hosts", Type: Create},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/.env", Type: Write},
+				Error: nil,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		actualChanges := []Changeset{}
+		if err := dw.watch(context.Background(), []string{"/foo/"}, []string{"/etc/hosts", "/foo/.env"}, func(c Changeset) error {
+			actualChanges = append(actualChanges, c)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+		expectedChanges := []Changeset{
+			{Changes: map[string]EventType{"/etc/hosts": Create}},
+			{Changes: map[string]EventType{"/foo/.env": Write}},
+		}
+		if len(deep.Equal(expectedChanges, actualChanges)) != 0 {
+			t.Errorf("handle(); expected %+v, got %+v", expectedChanges, actualChanges)
+		}
+	})
+
+	t.Run("Watches newly created directories and their sub-directories", func(t *testing.T) {
+		expectedWatched := []string{"/foo/", "/foo/bar/", "/foo/bar/baz/"}
+		actualWatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				// When we add the initial directory it's all we'll find, then
+				// when the event is raised for /foo/bar/ CREATE we'll find it
+				// and its subdir /foo/bar/baz/.
+				if dir == "/foo/" {
+					return walkFn(dir)
+				}
+				if dir == "/foo/bar/" {
+					if err := walkFn("/foo/bar/"); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+					return walkFn("/foo/bar/baz/")
+				}
+				t.Errorf("unexpected call to walkDirs('%s')", dir)
+				return nil
+			},
+			isDir: func(path string) bool {
+				// We will raise a few create events but only /foo/bar/ is a
+				// new directory.
+				return path == "/foo/bar/"
+			},
+			watcher: watcher,
+		}
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/foo/file.txt", Type: Create},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/file.txt", Type: Write},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/file.txt", Type: Rename},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/stuff.txt", Type: Create},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/stuff.txt", Type: Remove},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/bar/", Type: Create},
+				Error: nil,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+	})
+
+	t.Run("Watches directories named like editor temp files", func(t *testing.T) {
+		root := t.TempDir()
+		dir := filepath.Join(root, "4913")
+		sub := filepath.Join(dir, "bar~")
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		expectedWatched := []string{root, dir, sub}
+		actualWatched := []string{}
+		expectedUnwatched := []string{dir, sub}
+		actualUnwatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(dir string) error {
+				actualUnwatched = append(actualUnwatched, dir)
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(path string, walkFn func(string) error) error {
+				if err := walkFn(path); err != nil || path != dir {
+					return err
+				}
+				return walkFn(sub)
+			},
+			isDir:     isDir,
+			watcher:   watcher,
+			normalize: true,
+		}
+		go func() {
+			for _, event := range []FsEvent{
+				{Path: dir, Type: Create},
+				{Path: filepath.Join(sub, "main.go"), Type: Write},
+				{Path: filepath.Join(root, "main.go~"), Type: Create},
+			} {
+				watcher.events <- WatcherEvent{Event: event}
+			}
+			// The events are handled one at a time so the directory is only
+			// removed once the ones before have been handled.
+			if err := os.RemoveAll(dir); err != nil {
+				t.Error(err)
+			}
+			watcher.events <- WatcherEvent{Event: FsEvent{Path: dir, Type: Remove}}
+			close(watcher.events)
+		}()
+		actualChanges := []Changeset{}
+		if err := dw.watch(context.Background(), []string{root}, nil, func(c Changeset) error {
+			actualChanges = append(actualChanges, c)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected watched %+v, got %+v", expectedWatched, actualWatched)
+		}
+		if !reflect.DeepEqual(expectedUnwatched, actualUnwatched) {
+			t.Errorf("watch(); expected unwatched %+v, got %+v", expectedUnwatched, actualUnwatched)
+		}
+		expectedChanges := []Changeset{
+			{Changes: map[string]EventType{dir: Create}},
+			{Changes: map[string]EventType{filepath.Join(sub, "main.go"): Write}},
+			{Changes: map[string]EventType{dir: Remove}},
+		}
+		if len(deep.Equal(expectedChanges, actualChanges)) != 0 {
+			t.Errorf("watch(); expected %+v, got %+v", expectedChanges, actualChanges)
+		}
+	})
+
+	t.Run("Unwatches removed directories and their sub-directories", func(t *testing.T) {
+		expectedUnwatched := []string{"/foo/bar/", "/foo/bar/baz/"}
+		actualUnwatched := []string{}
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(dir string) error {
+				actualUnwatched = append(actualUnwatched, dir)
+				// The kernel has usually dropped the watch already.
+				return errors.New("non-existent watch")
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				for _, path := range []string{"/foo/", "/foo/bar/", "/foo/bar/baz/", "/foo/barn/"} {
+					if err := walkFn(path); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+				}
+				return nil
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/foo/file.txt", Type: Remove},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/bar", Type: Remove},
+				Error: nil,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedUnwatched, actualUnwatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedUnwatched, actualUnwatched)
+		}
+		expectedRegistry := map[string]string{"/foo": "/foo/", "/foo/barn": "/foo/barn/"}
+		if !reflect.DeepEqual(expectedRegistry, dw.watched) {
+			t.Errorf("watch(); expected registry %+v, got %+v", expectedRegistry, dw.watched)
+		}
+	})
+
+	t.Run("Re-watches renamed directories under their new names", func(t *testing.T) {
+		expectedWatched := []string{"/foo/", "/foo/bar/", "/foo/bar/baz/", "/foo/qux/", "/foo/qux/baz/"}
+		actualWatched := []string{}
+		expectedUnwatched := []string{"/foo/bar/", "/foo/bar/baz/"}
+		actualUnwatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(dir string) error {
+				actualUnwatched = append(actualUnwatched, dir)
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				tree := map[string][]string{
+					"/foo/":     {"/foo/", "/foo/bar/", "/foo/bar/baz/"},
+					"/foo/qux/": {"/foo/qux/", "/foo/qux/baz/"},
+				}
+				for _, path := range tree[dir] {
+					if err := walkFn(path); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+				}
+				return nil
+			},
+			isDir:   func(path string) bool { return path == "/foo/qux/" },
+			watcher: watcher,
+		}
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/foo/bar/", Type: Rename},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/qux/", Type: Create},
+				Error: nil,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+		if !reflect.DeepEqual(expectedUnwatched, actualUnwatched) {
+			t.Errorf("watch(); expected unwatched %+v, got %+v", expectedUnwatched, actualUnwatched)
+		}
+	})
+
+	t.Run("Rescans the tree when the Watcher overflows", func(t *testing.T) {
+		// /foo/bar/ is created and /foo/old/ removed while events are lost.
+		trees := [][]string{
+			{"/foo/", "/foo/old/"},
+			{"/foo/", "/foo/bar/"},
+		}
+		expectedWatched := []string{"/foo/", "/foo/old/", "/foo/bar/"}
+		actualWatched := []string{}
+		expectedUnwatched := []string{"/foo/old/"}
+		actualUnwatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(dir string) error {
+				actualUnwatched = append(actualUnwatched, dir)
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				tree := trees[0]
+				trees = trees[1:]
+				for _, path := range tree {
+					if err := walkFn(path); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+				}
+				return nil
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+		}
+		go func() {
+			watcher.events <- WatcherEvent{Error: ErrOverflow}
+			close(watcher.events)
+		}()
+		actualChanges := []Changeset{}
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(c Changeset) error {
+			actualChanges = append(actualChanges, c)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+		if !reflect.DeepEqual(expectedUnwatched, actualUnwatched) {
+			t.Errorf("watch(); expected unwatched %+v, got %+v", expectedUnwatched, actualUnwatched)
+		}
+		expectedChanges := []Changeset{{Errors: []error{ErrOverflow}, Overflowed: true}}
+		if len(deep.Equal(expectedChanges, actualChanges)) != 0 {
+			t.Errorf("handle(); expected %+v, got %+v", expectedChanges, actualChanges)
+		}
+	})
+
+	t.Run("Debounced events trigger new directory watches", func(t *testing.T) {
+		expectedWatched := []string{"/foo/", "/foo/bar/", "/foo/bar/baz/"}
+		actualWatched := []string{}
+		watcher := &testWatcher{
+			watch: func(dir string) error {
+				actualWatched = append(actualWatched, dir)
+				return nil
+			},
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				// When we add the initial directory it's all we'll find, then
+				// when the event is raised for /foo/bar/ CREATE we'll find it
+				// and its subdir /foo/bar/baz/.
+				if dir == "/foo/" {
+					return walkFn(dir)
+				}
+				if dir == "/foo/bar/" {
+					if err := walkFn("/foo/bar/"); err != nil {
+						t.Errorf("unexpected error from walkFn(): %+v", err)
+					}
+					return walkFn("/foo/bar/baz/")
+				}
+				t.Errorf("unexpected call to walkDirs('%s')", dir)
+				return nil
+			},
+			isDir: func(path string) bool {
+				// We will raise a few create events but only /foo/bar/ is a
+				// new directory.
+				return path == "/foo/bar/"
+			},
+			watcher: watcher,
+			// Make sure the directory add is debounced after the file remove.
+			debounceCount:    2,
+			debounceInterval: time.Minute,
+		}
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/foo/stuff.txt", Type: Remove},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/bar/", Type: Create},
+				Error: nil,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(_ Changeset) error { return nil }); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		if !reflect.DeepEqual(expectedWatched, actualWatched) {
+			t.Errorf("watch(); expected %+v, got %+v", expectedWatched, actualWatched)
+		}
+	})
+
+	t.Run("Debounced events are merged into a single Changeset", func(t *testing.T) {
+
+		watcher := &testWatcher{
+			watch: func(string) error { return nil },
+			unwatch: func(string) error {
+				t.Error("unexpected call to Unwatch()")
+				return nil
+			},
+			events: make(chan WatcherEvent),
+		}
+		dw := DirWatcher{
+			walkDirs: func(dir string, walkFn func(string) error) error {
+				return walkFn(dir)
+			},
+			isDir:   func(_ string) bool { return false },
+			watcher: watcher,
+			// Make sure all of the events are debounced into one window.
+			debounceCount:    3,
+			debounceInterval: time.Minute,
+		}
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		someError := errors.New("some error")
+		events := []WatcherEvent{
+			{
+				Event: FsEvent{Path: "/foo/bar/baz", Type: Create, Time: start},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/bar/baz", Type: Write, Time: start.Add(time.Second)},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{Path: "/foo/qux", Type: Remove, Time: start.Add(2 * time.Second)},
+				Error: nil,
+			},
+			{
+				Event: FsEvent{}, Error: someError,
+			},
+		}
+		go func() {
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.events)
+		}()
+		actualChanges := []Changeset{}
+		if err := dw.watch(context.Background(), []string{"/foo/"}, nil, func(c Changeset) error {
+			actualChanges = append(actualChanges, c)
+			return nil
+		}); err != nil {
+			t.Errorf("unexpected error from watch(): %+v", err)
+		}
+		expectedChanges := []Changeset{
+			{
+				Changes: map[string]EventType{
+					"/foo/bar/baz": Create | Write,
+					"/foo/qux":     Remove,
+				},
+				Errors: []error{someError},
+				Start:  start,
+				End:    start.Add(2 * time.Second),
+			},
+		}
+		if len(deep.Equal(expectedChanges, actualChanges)) != 0 {
+			t.Errorf("handle(); expected %+v, got %+v", expectedChanges, actualChanges)
+		}
+	})
+}
+
+func Test_rootFor(t *testing.T) {
+
+	roots := []string{".", "../shared", "vendor/lib"}
+	tests := []struct {
+		path     string
+		expected string
+		found    bool
+	}{
+		{path: "main.go", expected: ".", found: true},
+		{path: "./pkg/foo.go", expected: ".", found: true},
+		{path: "vendor/lib/lib.go", expected: "vendor/lib", found: true},
+		{path: "vendor/other.go", expected: ".", found: true},
+		{path: "../shared/x/y.go", expected: "../shared", found: true},
+		{path: "../sharedlib/y.go", expected: "", found: false},
+		{path: "/etc/hosts", expected: "", found: false},
+	}
+	for _, test := range tests {
+		actual, found := rootFor(roots, test.path)
+		if actual != test.expected || found != test.found {
+			t.Errorf("rootFor(%s); expected %s %v, got %s %v",
+				test.path, test.expected, test.found, actual, found)
+		}
+	}
+}
+
+func Test_DirWatcher_Watched(t *testing.T) {
+	dw := DirWatcher{
+		watched: map[string]string{
+			"src":     "./src",
+			"src/pkg": "./src/pkg",
+			".":       ".",
+		},
+		fileDirs: map[string]string{
+			"../config": "../config",
+			".":         ".",
+		},
+	}
+	expected := []string{".", "../config", "./src", "./src/pkg"}
+	if actual := dw.Watched(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Watched(); expected %+v, got %+v", expected, actual)
+	}
+}
+
+func Test_DirWatcher_Plan(t *testing.T) {
+	dw := DirWatcher{
+		walkDirs: func(dir string, walkFn func(string) error) error {
+			for _, sub := range []string{"", "/pkg"} {
+				if err := walkFn(dir + sub); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		roots:     []string{"src", "lib"},
+		filePaths: []string{"src/main.go", "../config/app.env"},
+	}
+	expected := []string{"../config", "lib", "lib/pkg", "src", "src/pkg"}
+	actual, err := dw.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error from Plan(): %+v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Plan(); expected %+v, got %+v", expected, actual)
+	}
+}
+
+type testWatcher struct {
+	watch   func(string) error
+	unwatch func(string) error
+	events  chan WatcherEvent
+}
+
+func (w *testWatcher) Watch(path string) error {
+	return w.watch(path)
+}
+
+func (w *testWatcher) Unwatch(path string) error {
+	return w.unwatch(path)
+}
+
+func (w *testWatcher) Events() <-chan WatcherEvent {
+	return w.events
+}
+
+func (w *testWatcher) Stop() {
+	close(w.events)
+}
+
+func Test_NewDryRun(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dw, err := NewDryRun([]string{root})
+	if err != nil {
+		t.Fatalf("unexpected error from NewDryRun(): %+v", err)
+	}
+	if dw.watcher != nil {
+		t.Errorf("NewDryRun(); expected no Watcher, got %T", dw.watcher)
+	}
+	expected := []string{root, filepath.Join(root, "pkg")}
+	actual, err := dw.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error from Plan(): %+v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Plan(); expected %+v, got %+v", expected, actual)
+	}
+	if err := dw.Watch(context.Background(), func(Changeset) error { return nil }); err == nil {
+		t.Errorf("Watch(); expected an error, got nil")
+	}
+}
@@ -0,0 +1,298 @@
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The Watcher interface is the interface the package consumes for file
+// watching. The standard implementation is a wrapper for fsnotify.
+
+// EventType represents the kinds of file system events.
+type EventType uint32
+
+// The kinds of file system events we're interested in. Their values match
+// the fsnotify.Op bits they're mapped from.
+const (
+	Create EventType = 1 << iota
+	Write
+	Remove
+	Rename
+
+	// Attrib means the permissions or other metadata of an entry changed.
+	Attrib
+)
+
+// The union of all the defined event types.
+const allEventTypes = Create | Write | Remove | Rename | Attrib
+
+func (t EventType) String() string {
+	var buffer bytes.Buffer
+
+	if t&Create == Create {
+		buffer.WriteString("|CREATE")
+	}
+	if t&Remove == Remove {
+		buffer.WriteString("|REMOVE")
+	}
+	if t&Write == Write {
+		buffer.WriteString("|WRITE")
+	}
+	if t&Rename == Rename {
+		buffer.WriteString("|RENAME")
+	}
+	if t&Attrib == Attrib {
+		buffer.WriteString("|ATTRIB")
+	}
+	if buffer.Len() == 0 {
+		return ""
+	}
+	return buffer.String()[1:]
+}
+
+// An FsEvent represents a file system event.
+type FsEvent struct {
+
+	// The path to the entry the event occured on.
+	Path string
+
+	// The type of the event that occurred.
+	Type EventType
+
+	// The time the event was received from the underlying watcher.
+	Time time.Time
+}
+
+func (e FsEvent) String() string {
+	return fmt.Sprintf("{%s %v}", e.Path, e.Type)
+}
+
+// ErrOverflow is the error a Watcher raises when it dropped events because
+// they arrived faster than they could be consumed.
+var ErrOverflow = errors.New("watcher event queue overflowed")
+
+// A WatcherEvent is raised by a Watcher when an event or error occurs.
+type WatcherEvent struct {
+
+	// The file system event. If Error is not nil then the meaning of Event is
+	// undefined.
+	Event FsEvent
+
+	// The error (possibly nil).
+	Error error
+}
+
+// A Watcher raises file system events for watched directories and files.
+type Watcher interface {
+
+	// Tells the watcher to begin watching the given file or directory (not recursive).
+	Watch(path string) error
+
+	// Stops watching the given file or directory.
+	Unwatch(path string) error
+
+	// The channel that the watcher communicates events and errors on.
+	Events() <-chan WatcherEvent
+
+	// Stops the Watcher. The Events channel is closed and the Watcher's
+	// goroutines have exited by the time Stop returns.
+	Stop()
+}
+
+// A Filter is a function that indicates whether an FsEvent should be
+// filtered out of the event stream emitted by a Watcher.
+type Filter func(event FsEvent) (bool, error)
+
+// A Filter that doesn't filter out any events.
+func noFilter(_ FsEvent) (bool, error) {
+	return false, nil
+}
+
+// Decides whether an event should be filtered out and gives the reason when
+// it should be.
+type reasonFilter func(event FsEvent) (reason string, err error)
+
+// Creates a reasonFilter that gives the reason for the events a Filter
+// filters out.
+func withReason(reason string, filter Filter) reasonFilter {
+	return func(event FsEvent) (string, error) {
+		skip, err := filter(event)
+		if err != nil || !skip {
+			return "", err
+		}
+		return reason, nil
+	}
+}
+
+// Creates a reasonFilter that filters out the events any of the given filters
+// filter out, giving the reason of the first.
+func firstReason(filters ...reasonFilter) reasonFilter {
+	return func(event FsEvent) (string, error) {
+		for _, filter := range filters {
+			if reason, err := filter(event); err != nil || reason != "" {
+				return reason, err
+			}
+		}
+		return "", nil
+	}
+}
+
+// NewWatcher creates a new Watcher that uses file system notifications. It
+// applies the WithFilter and WithLogger options.
+func NewWatcher(opts ...Option) (Watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	c := newConfig(opts)
+	w := &watcherImpl{
+		fsWatcher: fsWatcher,
+		events:    make(chan WatcherEvent, 1),
+		filter:    c.eventFilter(),
+		logger:    c.logger,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go w.start()
+	return w, nil
+}
+
+// An implementation of Watcher using fsnotify.
+type watcherImpl struct {
+	fsWatcher *fsnotify.Watcher
+	events    chan WatcherEvent
+	filter    reasonFilter
+	logger    Logger
+
+	// Closed by Stop to tell start to return, and by start when it has.
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// Tells the watcher to begin watching the given file or directory (not recursive).
+func (w *watcherImpl) Watch(path string) error {
+	if err := w.fsWatcher.Add(path); err != nil {
+		return fmt.Errorf("failed to add watcher: %w", err)
+	}
+	return nil
+}
+
+// Stops watching the given file or directory.
+func (w *watcherImpl) Unwatch(path string) error {
+	if err := w.fsWatcher.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove watcher: %w", err)
+	}
+	return nil
+}
+
+// The channel that the watcher communicates events and errors on.
+func (w *watcherImpl) Events() <-chan WatcherEvent {
+	return w.events
+}
+
+// Stops the Watcher.
+func (w *watcherImpl) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		if err := w.fsWatcher.Close(); err != nil {
+			logRecord(w.logger, newRecord(RecordError, Fields{"error": err.Error()},
+				"Error closing fsnotify.Watcher: %v", err).at(LevelWarn))
+		}
+	})
+	<-w.stopped
+}
+
+// Starts consuming the fsnotify events and maps them to WatcherEvents.
+func (w *watcherImpl) start() {
+	defer close(w.stopped)
+	defer close(w.events)
+	for {
+		var watcherEvent WatcherEvent
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if !isWatchedEvent(event) {
+				continue
+			}
+			fsEvent := newEvent(event)
+			if skipEvent(w.filter, fsEvent, w.logger) {
+				continue
+			}
+			watcherEvent = WatcherEvent{
+				Event: fsEvent,
+			}
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			if err == fsnotify.ErrEventOverflow {
+				err = ErrOverflow
+			}
+			watcherEvent = WatcherEvent{
+				Error: err,
+			}
+		}
+		// Don't block on a consumer that has gone away once we're stopped.
+		select {
+		case w.events <- watcherEvent:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Applies the filter to the given event and indicates whether it should be
+// skipped. Events are not skipped when the filter fails.
+func skipEvent(filter reasonFilter, event FsEvent, logger Logger) bool {
+	reason, err := filter(event)
+	if err != nil {
+		logRecord(logger, newRecord(RecordError, eventFields(event, Fields{"error": err.Error()}),
+			"watcher filter error: event=%v, error=%v", event, err).at(LevelWarn))
+		return false
+	}
+	if reason != "" {
+		logRecord(logger, newRecord(RecordFilter, eventFields(event, Fields{"reason": reason}),
+			"watcher filter: ignoring event %v (%s)", event, reason))
+	}
+	return reason != ""
+}
+
+// Describes an event as Fields, adding them to the given Fields.
+func eventFields(event FsEvent, fields Fields) Fields {
+	if fields == nil {
+		fields = Fields{}
+	}
+	fields["path"] = event.Path
+	fields["op"] = event.Type.String()
+	return fields
+}
+
+// Indicates whether an fsnotify.Event represents and event that we care about.
+func isWatchedEvent(event fsnotify.Event) bool {
+	// fsnotify reports events without a name when they arrive for a watch
+	// that was removed after the kernel queued them.
+	if event.Name == "" {
+		return false
+	}
+	return EventType(event.Op)&allEventTypes != 0
+}
+
+// Maps an fsnotify.Event to a WatcherEvent. Each bit of the fsnotify.Op maps
+// to the EventType with the same value.
+func newEvent(event fsnotify.Event) FsEvent {
+	return FsEvent{
+		Path: event.Name,
+		Type: EventType(event.Op) & allEventTypes,
+		Time: time.Now(),
+	}
+}
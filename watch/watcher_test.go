@@ -0,0 +1,36 @@
+package watch
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_firstReason(t *testing.T) {
+
+	never := func(FsEvent) (bool, error) { return false, nil }
+	always := func(FsEvent) (bool, error) { return true, nil }
+	someError := errors.New("some error")
+	failing := func(FsEvent) (bool, error) { return false, someError }
+
+	tests := []struct {
+		name     string
+		filters  []reasonFilter
+		expected string
+		err      error
+	}{
+		{name: "keeps events no filter filters out",
+			filters: []reasonFilter{withReason(ReasonFilter, never), withReason(ReasonGitIgnore, never)}},
+		{name: "gives the reason of the first filter to filter out",
+			filters:  []reasonFilter{withReason(ReasonFilter, never), withReason(ReasonGitIgnore, always), withReason(ReasonFilter, always)},
+			expected: ReasonGitIgnore},
+		{name: "stops at the first error",
+			filters: []reasonFilter{withReason(ReasonFilter, failing), withReason(ReasonGitIgnore, always)},
+			err:     someError},
+	}
+	for _, test := range tests {
+		reason, err := firstReason(test.filters...)(FsEvent{Path: "foo"})
+		if reason != test.expected || err != test.err {
+			t.Errorf("%s: expected %q %v, got %q %v", test.name, test.expected, test.err, reason, err)
+		}
+	}
+}
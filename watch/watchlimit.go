@@ -0,0 +1,64 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// A WatchLimitError is returned when the system runs out of watches before
+// a whole directory tree can be watched.
+type WatchLimitError struct {
+
+	// The number of directories that needed watches.
+	Needed int
+
+	// The name of the system setting that limits watches, or empty if it's
+	// unknown.
+	LimitName string
+
+	// The value of the limit, or zero if it's unknown.
+	Limit int
+
+	// The error returned by the Watcher.
+	Err error
+}
+
+func (e *WatchLimitError) Error() string {
+	switch {
+	case e.LimitName == "":
+		return fmt.Sprintf("watch limit reached watching %d directories: %v", e.Needed, e.Err)
+	case e.Needed == 0:
+		return fmt.Sprintf("watch limit reached: %s is %d: %v", e.LimitName, e.Limit, e.Err)
+	}
+	return fmt.Sprintf("watch limit reached: %d directories need watches but %s is %d: %v",
+		e.Needed, e.LimitName, e.Limit, e.Err)
+}
+
+func (e *WatchLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Creates a WatchLimitError for the given number of directories and the
+// error the Watcher returned, looking up the limit that was exhausted.
+func newWatchLimitError(needed int, err error) *WatchLimitError {
+	limitErr := &WatchLimitError{
+		Needed: needed,
+		Err:    err,
+	}
+	name := "max_user_watches"
+	if errors.Is(err, syscall.EMFILE) {
+		name = "max_user_instances"
+	}
+	if limit, ok := inotifyLimit(name); ok {
+		limitErr.LimitName = "fs.inotify." + name
+		limitErr.Limit = limit
+	}
+	return limitErr
+}
+
+// IsWatchLimit indicates whether the given error means the system has run out
+// of watches.
+func IsWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
@@ -0,0 +1,99 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func Test_WatchLimitError(t *testing.T) {
+
+	err := errors.New("no space left on device")
+	tests := []struct {
+		name     string
+		limitErr WatchLimitError
+		expected string
+	}{
+		{
+			name:     "Describes the directories and the limit",
+			limitErr: WatchLimitError{Needed: 9000, LimitName: "fs.inotify.max_user_watches", Limit: 8192, Err: err},
+			expected: "watch limit reached: 9000 directories need watches but fs.inotify.max_user_watches is 8192: no space left on device",
+		},
+		{
+			name:     "Describes the limit when the directories are unknown",
+			limitErr: WatchLimitError{LimitName: "fs.inotify.max_user_instances", Limit: 128, Err: err},
+			expected: "watch limit reached: fs.inotify.max_user_instances is 128: no space left on device",
+		},
+		{
+			name:     "Describes the directories when the limit is unknown",
+			limitErr: WatchLimitError{Needed: 9000, Err: err},
+			expected: "watch limit reached watching 9000 directories: no space left on device",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := test.limitErr.Error(); actual != test.expected {
+				t.Errorf("Error(); expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_IsWatchLimit(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: fmt.Errorf("failed to add watcher: %w", syscall.ENOSPC), expected: true},
+		{err: fmt.Errorf("failed to create watcher: %w", syscall.EMFILE), expected: true},
+		{err: newWatchLimitError(3, syscall.ENOSPC), expected: true},
+		{err: syscall.ENOENT, expected: false},
+		{err: errors.New("no space left on device"), expected: false},
+	}
+	for _, test := range tests {
+		if actual := IsWatchLimit(test.err); actual != test.expected {
+			t.Errorf("IsWatchLimit(%v); expected %v, got %v", test.err, test.expected, actual)
+		}
+	}
+}
+
+func Test_DirWatcher_watchDir_limit(t *testing.T) {
+
+	// Walks five directories with a Watcher that runs out after two.
+	watched := 0
+	dw := DirWatcher{
+		walkDirs: func(dir string, walkFn func(string) error) error {
+			for _, sub := range []string{"", "/a", "/b", "/c", "/d"} {
+				if err := walkFn(dir + sub); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		isDir: func(string) bool { return true },
+		watcher: &testWatcher{
+			watch: func(string) error {
+				if watched == 2 {
+					return fmt.Errorf("failed to add watcher: %w", syscall.ENOSPC)
+				}
+				watched++
+				return nil
+			},
+			unwatch: func(string) error { return nil },
+			events:  make(chan WatcherEvent),
+		},
+	}
+	err := dw.watch(context.Background(), []string{"/foo"}, nil, func(Changeset) error { return nil })
+	var limitErr *WatchLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("watch(); expected a WatchLimitError, got %v", err)
+	}
+	if limitErr.Needed != 5 {
+		t.Errorf("expected 5 directories to need watches, got %d", limitErr.Needed)
+	}
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("expected the WatchLimitError to wrap the Watcher's error, got %v", err)
+	}
+}